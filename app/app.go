@@ -0,0 +1,126 @@
+package app
+
+import (
+	"gorm.io/gorm"
+	"wyvern-api/config"
+	"wyvern-api/migrations"
+	"wyvern-api/repositories"
+	"wyvern-api/routers"
+	"wyvern-api/services"
+	"wyvern-api/utils"
+)
+
+// App the application wired once: config, database, repositories and services. Controllers get their services
+// through constructors, so nothing is built per request and two Apps on different databases can run side by side.
+type App struct {
+	Config  *config.Config
+	DB      *gorm.DB
+	Workers *utils.Workers
+
+	Repositories Repositories
+	Services     Services
+}
+
+// Repositories of App
+type Repositories struct {
+	Users           *repositories.UserRepo
+	Transactions    *repositories.TransactionRepo
+	Adjustments     *repositories.AdjustmentRepo
+	BalanceShards   *repositories.BalanceShardRepo
+	RuntimeSettings *repositories.RuntimeSettingRepo
+}
+
+// Services of App
+type Services struct {
+	Transactions *services.TransactionService
+	Adjustments  *services.AdjustmentService
+	Shards       *services.ShardService
+	Health       *services.HealthService
+	// Writer nil unless single writer mode is enabled
+	Writer          *services.AccountWriter
+	Replicas        *services.ReplicaRouter
+	RuntimeSettings *services.RuntimeSettings
+}
+
+// New wire App on db, the primary, and replicaDBs by address, with the features enabled in cfg.
+// Background work starts with Start.
+func New(cfg *config.Config, db *gorm.DB, replicaDBs map[string]*gorm.DB) (*App, error) {
+	a := &App{
+		Config:  cfg,
+		DB:      db,
+		Workers: utils.NewWorkers(),
+		Repositories: Repositories{
+			Users:           repositories.NewUserRepo(db),
+			Transactions:    repositories.NewTransactionRepo(db),
+			Adjustments:     repositories.NewAdjustmentRepo(db),
+			BalanceShards:   repositories.NewBalanceShardRepo(db),
+			RuntimeSettings: repositories.NewRuntimeSettingRepo(db),
+		},
+	}
+	repos := a.Repositories
+
+	strategy, err := services.NewConfiguredBalanceStrategy(cfg, repos.Users, repos.BalanceShards)
+	if err != nil {
+		return nil, err
+	}
+
+	// single writer mode, credits/debits of a user are committed by the one worker owning it
+	if cfg.SingleWriterEnabled {
+		a.Services.Writer = services.NewAccountWriter(cfg, repos.Transactions, strategy, services.NewGormTxRunner(cfg, db))
+	}
+
+	// history reads go to a replica while its lag is within DB_REPLICA_MAX_LAG
+	a.Services.Replicas = services.NewReplicaRouter(db, replicaDBs, cfg.DbReplicaMaxLag, cfg.DbQueryTimeout)
+
+	a.Services.Transactions = services.NewTransactionService(cfg, repos.Transactions, strategy, services.NewGormTxRunner(cfg, db), a.Services.Writer, db, a.Services.Replicas)
+	a.Services.Adjustments = services.NewAdjustmentService(cfg, repos.Adjustments, a.Services.Transactions, services.NewGormTxRunner(cfg, db), db)
+	a.Services.Shards = services.NewShardService(cfg, repos.Users, repos.BalanceShards, services.NewGormTxRunner(cfg, db), db)
+
+	// readiness fails while the schema is behind this build; there is no outbox yet, so no outbox lag to report
+	migrator, err := migrations.New(db, cfg.DbMigrationLockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	a.Services.Health = services.NewHealthService(db, cfg.HealthDBTimeout, services.NewMigrationChecker(migrator, cfg.HealthDBTimeout))
+
+	var sp services.RuntimeSettingProcessor
+	if cfg.RuntimeSettingsTableEnabled {
+		sp = repos.RuntimeSettings
+	}
+	a.Services.RuntimeSettings = services.NewRuntimeSettings(sp, db, cfg.DbQueryTimeout)
+
+	return a, nil
+}
+
+// Start is method to start the background workers of the enabled features on Workers
+func (a *App) Start() {
+	if a.Services.Writer != nil {
+		a.Services.Writer.Start(a.Workers)
+	}
+
+	// keep the shards of hot accounts even, so a debit locks as few of them as possible
+	if a.Config.BalanceShardingEnabled && a.Config.BalanceShardRebalanceInterval > 0 {
+		a.Services.Shards.StartRebalancer(a.Workers, a.Config.BalanceShardRebalanceInterval)
+	}
+
+	// log level, rate limits and transaction limits follow the env files, and the runtime_settings table when enabled
+	if a.Config.RuntimeSettingsInterval > 0 {
+		a.Services.RuntimeSettings.Start(a.Workers, a.Config.RuntimeSettingsInterval)
+	}
+
+	a.Services.Replicas.Start(a.Workers, a.Config.DbReplicaLagCheckInterval)
+}
+
+// RouterServices is method to hand the services and the router settings of App to routers.Routes
+func (a *App) RouterServices() routers.Services {
+	return routers.Services{
+		Transactions:       a.Services.Transactions,
+		Adjustments:        a.Services.Adjustments,
+		Health:             a.Services.Health,
+		RateLimitEnabled:   a.Config.RateLimitEnabled,
+		TrustedProxies:     a.Config.TrustedProxyList(),
+		OperatorKeys:       a.Config.OperatorKeys(),
+		ErrorFormat:        a.Config.ErrorFormat,
+		TracingServiceName: a.Config.TracingServiceName,
+	}
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+	"wyvern-api/config"
+	"wyvern-api/migrations"
+	"wyvern-api/models"
+)
+
+func TestNew(t *testing.T) {
+	cfg := &config.Config{
+		BalanceStrategy:      "pessimistic",
+		DbTransactionTimeout: 5 * time.Second,
+		DbQueryTimeout:       5 * time.Second,
+		DbRetryMaxAttempts:   1,
+		HealthDBTimeout:      time.Second,
+	}
+
+	t.Run("two apps side by side", func(t *testing.T) {
+		first, err := New(cfg, migrations.NewTestDB(t), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := New(cfg, migrations.NewTestDB(t), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range []*App{first, second} {
+			a.DB.Create(&models.User{Username: "Fulan"})
+		}
+
+		if _, err := first.Services.Transactions.Credit(context.Background(), models.CreditRequest{UserID: 1, Amount: 10}); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, a := range map[string]*App{"first": first, "second": second} {
+			user, err := a.Repositories.Users.FindByID(context.Background(), a.DB, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := map[string]float64{"first": 10, "second": 0}[name]
+			if user.Balance != expected {
+				t.Errorf("%s: expected balance %v, got %v", name, expected, user.Balance)
+			}
+		}
+	})
+
+	t.Run("not ready while migrations are pending", func(t *testing.T) {
+		db := migrations.NewTestDB(t)
+		a, err := New(cfg, db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report, ready := a.Services.Health.Readiness(context.Background()); !ready {
+			t.Fatalf("expected ready on a migrated database, got %+v", report)
+		}
+
+		migrator, _ := migrations.New(db, time.Minute)
+		if err := migrator.Down(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		report, ready := a.Services.Health.Readiness(context.Background())
+		if ready || report.Checks["migrations"].Status != models.HealthStatusFailing {
+			t.Errorf("expected failing migrations check, got %+v", report)
+		}
+	})
+
+	t.Run("features of the config", func(t *testing.T) {
+		features := *cfg
+		features.SingleWriterEnabled = true
+		a, err := New(&features, migrations.NewTestDB(t), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Services.Writer == nil {
+			t.Error("expected writer in single writer mode")
+		}
+
+		features.BalanceStrategy = "eventual"
+		if _, err := New(&features, migrations.NewTestDB(t), nil); err == nil {
+			t.Error("expected error for unknown balance strategy")
+		}
+	})
+}
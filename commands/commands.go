@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"wyvern-api/config"
+)
+
+// command one admin subcommand, run instead of the server
+type command struct {
+	usage string
+	// db the command needs config.DB, it is connected before run
+	db bool
+	// standalone the command runs before the config is loaded and must not use it, so it still works when
+	// the config can not be loaded
+	standalone bool
+	run        func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"config":  {usage: configUsage, run: Config},
+	"migrate": {usage: migrateUsage, db: true, run: Migrate},
+	"secrets": {usage: secretsUsage, standalone: true, run: Secrets},
+	"shards":  {usage: shardsUsage, db: true, run: Shards},
+}
+
+// Run is method to run the admin subcommand args[0] with the rest of args
+func Run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", usage())
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, usage: %s", args[0], usage())
+	}
+	if cmd.db {
+		config.LoadDB()
+	}
+	if err := cmd.run(ctx, args[1:]); err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	return nil
+}
+
+// Standalone is method to tell whether the admin subcommand args[0] runs without the config
+func Standalone(args []string) bool {
+	return len(args) > 0 && commands[args[0]].standalone
+}
+
+// usage of every command
+func usage() string {
+	usages := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		usages = append(usages, cmd.usage)
+	}
+	sort.Strings(usages)
+
+	return strings.Join(usages, " | ")
+}
@@ -0,0 +1,21 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"wyvern-api/config"
+)
+
+const configUsage = "config print"
+
+// Config print the effective config, after every layer, flags and profile, as KEY=value with secrets masked
+func Config(_ context.Context, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return fmt.Errorf("usage: %s", configUsage)
+	}
+
+	for _, setting := range config.Effective() {
+		fmt.Printf("%s=%s\n", setting.Key, setting.Value)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"wyvern-api/config"
+	"wyvern-api/migrations"
+)
+
+const migrateUsage = "migrate up|down|status|to <version>"
+
+// Migrate apply or revert the embedded schema migrations, or print their status
+func Migrate(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", migrateUsage)
+	}
+	migrator, err := migrations.New(config.DB, config.ENV.DbMigrationLockTimeout)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		return migrator.Up(ctx)
+	case args[0] == "down" && len(args) == 1:
+		return migrator.Down(ctx)
+	case args[0] == "to" && len(args) == 2:
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		return migrator.To(ctx, version)
+	case args[0] == "status" && len(args) == 1:
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("usage: %s", migrateUsage)
+}
@@ -0,0 +1,174 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"wyvern-api/secrets"
+)
+
+const secretsUsage = "secrets keygen|encrypt [value]|decrypt <value>|rotate <new key file> <env file>"
+
+// Secrets generate a key, encrypt or decrypt a config value with the key of SECRETS_KEY or SECRETS_KEY_FILE,
+// or re-encrypt every enc: value of an env file with a new key. encrypt reads the value from stdin when it is
+// not given, so it stays out of the shell history.
+func Secrets(_ context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", secretsUsage)
+	}
+
+	switch {
+	case args[0] == "keygen" && len(args) == 1:
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println(key)
+		return nil
+	case args[0] == "encrypt" && len(args) <= 2:
+		cipher, err := secrets.LoadCipher()
+		if err != nil {
+			return err
+		}
+		value, err := argOrStdin(args[1:])
+		if err != nil {
+			return err
+		}
+		encrypted, err := cipher.Encrypt(value)
+		if err != nil {
+			return err
+		}
+		fmt.Println(encrypted)
+		return nil
+	case args[0] == "decrypt" && len(args) == 2:
+		cipher, err := secrets.LoadCipher()
+		if err != nil {
+			return err
+		}
+		value, err := cipher.Decrypt(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	case args[0] == "rotate" && len(args) == 3:
+		return rotate(args[1], args[2])
+	default:
+		return fmt.Errorf("usage: %s", secretsUsage)
+	}
+}
+
+// argOrStdin the only arg, or the first line of stdin without it
+func argOrStdin(args []string) (string, error) {
+	if len(args) == 1 {
+		return args[0], nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// rotate re-encrypt the enc: values of envFile, decrypted with the current key, with the key of newKeyFile.
+// The file is only rewritten when every value could be decrypted, and it is replaced as a whole, so a crash
+// leaves either the old or the new file, never a torn one.
+func rotate(newKeyFile string, envFile string) error {
+	current, err := secrets.LoadCipher()
+	if err != nil {
+		return err
+	}
+	key, err := secrets.ReadKeyFile(newKeyFile)
+	if err != nil {
+		return err
+	}
+	next, err := secrets.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(envFile)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(envFile)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(string(content), "\n")
+	rotated := 0
+	for i, line := range lines {
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(strings.TrimSpace(name), "#") {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		if !strings.HasPrefix(value, secrets.EncryptedPrefix) {
+			continue
+		}
+
+		plaintext, err := current.Decrypt(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", strings.TrimSpace(name), err)
+		}
+		encrypted, err := next.Encrypt(plaintext)
+		if err != nil {
+			return err
+		}
+		lines[i] = fmt.Sprintf("%s=%q", name, encrypted)
+		rotated++
+	}
+
+	if err := replaceFile(envFile, []byte(strings.Join(lines, "\n")), info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d values re-encrypted, switch %s or %s to the new key before the next start\n", rotated, secrets.KeyEnv, secrets.KeyFileEnv)
+	return nil
+}
+
+// replaceFile write content to a temp file next to path, fsync it and rename it over path
+func replaceFile(path string, content []byte, perm os.FileMode) (err error) {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(content); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// persist the rename itself, best effort, not every platform can sync a directory
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"wyvern-api/config"
+	"wyvern-api/repositories"
+	"wyvern-api/services"
+)
+
+const shardsUsage = "shards <user_id> <count>"
+
+// Shards spread the balance of a user over count balance shards, 0 unshards it.
+// It runs in one transaction against the live database, the server keeps serving meanwhile.
+func Shards(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s", shardsUsage)
+	}
+	userID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid user_id %q", args[0])
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid count %q", args[1])
+	}
+
+	svc := services.NewShardService(config.ENV, repositories.NewUserRepo(config.DB), repositories.NewBalanceShardRepo(config.DB), services.NewGormTxRunner(config.ENV, config.DB), config.DB)
+	balance, err := svc.SetShardCount(ctx, userID, count)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("user %d: balance %v over %d shards\n", userID, balance, count)
+	return nil
+}
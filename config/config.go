@@ -1,39 +1,449 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"wyvern-api/secrets"
+)
 
 // Config struct
 type Config struct {
-	Port       string `mapstructure:"PORT"`
-	DbUsername string `mapstructure:"DB_USERNAME"`
-	DbPassword string `mapstructure:"DB_PASSWORD"`
-	DbURL      string `mapstructure:"DB_URL"`
-	DbPort     string `mapstructure:"DB_PORT"`
-	DbDatabase string `mapstructure:"DB_DATABASE"`
-	DbDebug    bool   `mapstructure:"DB_DEBUG"`
+	Profile string `mapstructure:"APP_PROFILE"`
+	Port    string `mapstructure:"PORT"`
+	// TrustedProxies IPs or CIDRs whose X-Forwarded-For is believed for the client IP, see TrustedProxyList
+	TrustedProxies string `mapstructure:"TRUSTED_PROXIES"`
+	DbDriver       string `mapstructure:"DB_DRIVER"`
+	DbUsername     string `mapstructure:"DB_USERNAME"`
+	DbPassword     string `mapstructure:"DB_PASSWORD" secret:"true"`
+	DbURL          string `mapstructure:"DB_URL"`
+	DbPort         string `mapstructure:"DB_PORT"`
+	DbDatabase     string `mapstructure:"DB_DATABASE"`
+	DbSSLMode      string `mapstructure:"DB_SSL_MODE"`
+	DbDebug        bool   `mapstructure:"DB_DEBUG"`
+
+	DbTransactionTimeout time.Duration `mapstructure:"DB_TRANSACTION_TIMEOUT"`
+	DbQueryTimeout       time.Duration `mapstructure:"DB_QUERY_TIMEOUT"`
+	DbLockWaitTimeout    time.Duration `mapstructure:"DB_LOCK_WAIT_TIMEOUT"`
+
+	DbMigrationLockTimeout time.Duration `mapstructure:"DB_MIGRATION_LOCK_TIMEOUT"`
+
+	DbMaxOpenConns    int           `mapstructure:"DB_MAX_OPEN_CONNS"`
+	DbMaxIdleConns    int           `mapstructure:"DB_MAX_IDLE_CONNS"`
+	DbConnMaxLifetime time.Duration `mapstructure:"DB_CONN_MAX_LIFETIME"`
+	DbConnMaxIdleTime time.Duration `mapstructure:"DB_CONN_MAX_IDLE_TIME"`
+
+	DbReplicas                string        `mapstructure:"DB_REPLICAS"`
+	DbReplicaMaxLag           time.Duration `mapstructure:"DB_REPLICA_MAX_LAG"`
+	DbReplicaLagCheckInterval time.Duration `mapstructure:"DB_REPLICA_LAG_CHECK_INTERVAL"`
+
+	BalanceStrategy string `mapstructure:"BALANCE_STRATEGY"`
+
+	SingleWriterEnabled   bool `mapstructure:"SINGLE_WRITER_ENABLED"`
+	SingleWriterShards    int  `mapstructure:"SINGLE_WRITER_SHARDS"`
+	SingleWriterMaxBatch  int  `mapstructure:"SINGLE_WRITER_MAX_BATCH"`
+	SingleWriterQueueSize int  `mapstructure:"SINGLE_WRITER_QUEUE_SIZE"`
+
+	BalanceShardingEnabled        bool          `mapstructure:"BALANCE_SHARDING_ENABLED"`
+	BalanceShardMax               int           `mapstructure:"BALANCE_SHARD_MAX"`
+	BalanceShardRebalanceInterval time.Duration `mapstructure:"BALANCE_SHARD_REBALANCE_INTERVAL"`
+
+	DbRetryMaxAttempts int           `mapstructure:"DB_RETRY_MAX_ATTEMPTS"`
+	DbRetryBaseDelay   time.Duration `mapstructure:"DB_RETRY_BASE_DELAY"`
+	DbRetryMaxDelay    time.Duration `mapstructure:"DB_RETRY_MAX_DELAY"`
+
+	AdjustmentTTL time.Duration `mapstructure:"ADJUSTMENT_TTL"`
+	// AdjustmentOperatorKeys operator=key pairs, comma separated, see OperatorKeys
+	AdjustmentOperatorKeys string `mapstructure:"ADJUSTMENT_OPERATOR_KEYS" secret:"true"`
+	// AdjustmentApprovalThreshold credits/debits above it are refused, they go through an approved adjustment; 0 disables
+	AdjustmentApprovalThreshold float64 `mapstructure:"ADJUSTMENT_APPROVAL_THRESHOLD"`
+
+	RateLimitEnabled     bool    `mapstructure:"RATE_LIMIT_ENABLED"`
+	RateLimitIPRate      float64 `mapstructure:"RATE_LIMIT_IP_RATE" reload:"true"`
+	RateLimitIPBurst     int     `mapstructure:"RATE_LIMIT_IP_BURST" reload:"true"`
+	RateLimitAPIKeyRate  float64 `mapstructure:"RATE_LIMIT_API_KEY_RATE" reload:"true"`
+	RateLimitAPIKeyBurst int     `mapstructure:"RATE_LIMIT_API_KEY_BURST" reload:"true"`
+	RateLimitUserRate    float64 `mapstructure:"RATE_LIMIT_USER_RATE" reload:"true"`
+	RateLimitUserBurst   int     `mapstructure:"RATE_LIMIT_USER_BURST" reload:"true"`
+
+	ErrorFormat string `mapstructure:"ERROR_FORMAT"`
+
+	TransactionMaxAmount       float64 `mapstructure:"TRANSACTION_MAX_AMOUNT" reload:"true"`
+	TransactionAmountPrecision int     `mapstructure:"TRANSACTION_AMOUNT_PRECISION"`
+
+	HealthDBTimeout time.Duration `mapstructure:"HEALTH_DB_TIMEOUT"`
+
+	ShutdownTimeout    time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
+	ShutdownDrainDelay time.Duration `mapstructure:"SHUTDOWN_DRAIN_DELAY"`
+
+	TracingExporter     string  `mapstructure:"TRACING_EXPORTER"`
+	TracingServiceName  string  `mapstructure:"TRACING_SERVICE_NAME"`
+	TracingOTLPEndpoint string  `mapstructure:"TRACING_OTLP_ENDPOINT"`
+	TracingOTLPInsecure bool    `mapstructure:"TRACING_OTLP_INSECURE"`
+	TracingFile         string  `mapstructure:"TRACING_FILE"`
+	TracingSampleRatio  float64 `mapstructure:"TRACING_SAMPLE_RATIO"`
+
+	RuntimeSettingsInterval     time.Duration `mapstructure:"RUNTIME_SETTINGS_INTERVAL"`
+	RuntimeSettingsTableEnabled bool          `mapstructure:"RUNTIME_SETTINGS_TABLE_ENABLED"`
+
+	LoggingLevel  string `mapstructure:"LOGGING_LEVEL" reload:"true"`
+	LoggingFormat string `mapstructure:"LOGGING_FORMAT"`
 }
 
 // ENV const
 var ENV *Config
 
-// LoadConfig load config based on env file
-func LoadConfig() {
-	viper.AddConfigPath("./config")
-	viper.SetConfigName(".env")
-	viper.SetConfigType("env")
+// Version build version, set by -ldflags "-X wyvern-api/config.Version=1.2.3"
+var Version = "dev"
+
+// DefaultConfigFile env file read when -config is not given, it may be missing
+const DefaultConfigFile = "config/.env"
+
+// LoadConfig load config in layers, each overriding the one before: defaults, the env file, the values of the
+// profile, the env file of the profile (<file>.<profile>, e.g. config/.env.prod), environment variables and the
+// -set flags. The config is validated, every invalid value is reported.
+// It returns args left after the flags, the admin subcommand if any.
+func LoadConfig(args []string) ([]string, error) {
+	result, err := load(args, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ENV = result.cfg
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+	reloader.args, reloader.files = args, result.files
+	store.Store(result.v)
+	current.Store(result.cfg)
+
+	return result.args, nil
+}
+
+// loaded config of one load
+type loaded struct {
+	v   *viper.Viper
+	cfg *Config
+	// args left after the flags
+	args []string
+	// env files read, or that would be read when present
+	files []string
+}
+
+// SubcommandArgs args left after the flags, the admin subcommand if any, without loading the config
+func SubcommandArgs(args []string) ([]string, error) {
+	parsed, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsed.args, nil
+}
+
+// cliFlags flags of the command line
+type cliFlags struct {
+	file      string
+	profile   string
+	overrides setFlag
+	// args left after the flags
+	args []string
+}
+
+// parseFlags parse the flags of args
+func parseFlags(args []string) (cliFlags, error) {
+	flags := flag.NewFlagSet("wyvern-api", flag.ContinueOnError)
+	file := flags.String("config", DefaultConfigFile, "env file")
+	profile := flags.String("profile", os.Getenv("APP_PROFILE"), "dev, test or prod (default dev, or APP_PROFILE)")
+	var overrides setFlag
+	flags.Var(&overrides, "set", "KEY=value overriding every other layer, repeatable")
+	if err := flags.Parse(args); err != nil {
+		return cliFlags{}, err
+	}
+	if *profile == "" {
+		*profile = ProfileDev
+	}
+
+	return cliFlags{file: *file, profile: *profile, overrides: overrides, args: flags.Args()}, nil
+}
+
+// load read and validate the config of args, runtime overrides every other layer
+func load(args []string, runtime map[string]string) (loaded, error) {
+	parsed, err := parseFlags(args)
+	if err != nil {
+		return loaded{}, err
+	}
+	values, ok := profiles[parsed.profile]
+	if !ok {
+		return loaded{}, fmt.Errorf("APP_PROFILE: unknown profile %q, must be one of %s", parsed.profile, strings.Join(profileNames(), ", "))
+	}
+
+	v := viper.New()
+	v.SetConfigType("env")
+	setDefaults(v)
+
+	if err := readFile(v, parsed.file, parsed.file != DefaultConfigFile); err != nil {
+		return loaded{}, err
+	}
+	if err := v.MergeConfigMap(values); err != nil {
+		return loaded{}, err
+	}
+	if err := readFile(v, profileFile(parsed.file, parsed.profile), false); err != nil {
+		return loaded{}, err
+	}
+
+	// environment variables by the same name, also for keys without a default nor a file value
+	v.AutomaticEnv()
+	for _, key := range keys() {
+		if err := v.BindEnv(key); err != nil {
+			return loaded{}, err
+		}
+	}
+	for key, value := range parsed.overrides {
+		v.Set(key, value)
+	}
+	for key, value := range runtime {
+		v.Set(key, value)
+	}
+	v.Set("APP_PROFILE", parsed.profile)
+
+	cfg := &Config{}
+	if err := v.Unmarshal(cfg); err != nil {
+		return loaded{}, err
+	}
+	if err := resolveSecrets(cfg, secrets.NewResolver(nil)); err != nil {
+		return loaded{}, err
+	}
+	if err := Validate(cfg); err != nil {
+		return loaded{}, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return loaded{v: v, cfg: cfg, args: parsed.args, files: []string{parsed.file, profileFile(parsed.file, parsed.profile)}}, nil
+}
+
+// profileFile env file of profile next to file
+func profileFile(file string, profile string) string {
+	return file + "." + profile
+}
+
+// readFile merge the env file at path into v, a missing file is skipped unless required
+func readFile(v *viper.Viper, path string, required bool) error {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) && !required {
+			return nil
+		}
+		return err
+	}
+
+	v.SetConfigFile(path)
+	if err := v.MergeInConfig(); err != nil {
+		return fmt.Errorf("failed read %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// setFlag -set KEY=value flags
+type setFlag map[string]string
+
+// String implement flag.Value
+func (f *setFlag) String() string {
+	return fmt.Sprint(map[string]string(*f))
+}
+
+// Set implement flag.Value
+func (f *setFlag) Set(value string) error {
+	key, setting, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected KEY=value, got %q", value)
+	}
+	if *f == nil {
+		*f = setFlag{}
+	}
+	(*f)[strings.ToUpper(key)] = setting
+
+	return nil
+}
+
+// keys mapstructure key of every Config field
+func keys() []string {
+	configType := reflect.TypeOf(Config{})
+	keys := make([]string, 0, configType.NumField())
+	for i := 0; i < configType.NumField(); i++ {
+		keys = append(keys, configType.Field(i).Tag.Get("mapstructure"))
+	}
+
+	return keys
+}
+
+// resolveSecrets replace the enc: and file: values of the secret fields of cfg by the secret they refer to
+func resolveSecrets(cfg *Config, resolver *secrets.Resolver) error {
+	value := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Tag.Get("secret") != "true" || field.Type.Kind() != reflect.String {
+			continue
+		}
+
+		secret, err := resolver.Resolve(value.Field(i).String())
+		if err != nil {
+			// never the value, it may be the secret
+			return fmt.Errorf("%s: %w", field.Tag.Get("mapstructure"), err)
+		}
+		value.Field(i).SetString(secret)
+	}
+
+	return nil
+}
+
+// setDefaults register default value for optional config
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("PORT", "8080")
+	v.SetDefault("TRUSTED_PROXIES", "")
+	v.SetDefault("DB_DRIVER", "mysql")
+	v.SetDefault("DB_SSL_MODE", "disable")
+	v.SetDefault("DB_TRANSACTION_TIMEOUT", "10s")
+	v.SetDefault("DB_QUERY_TIMEOUT", "5s")
+	v.SetDefault("DB_LOCK_WAIT_TIMEOUT", "3s")
+	v.SetDefault("DB_MIGRATION_LOCK_TIMEOUT", "1m")
+	v.SetDefault("DB_MAX_OPEN_CONNS", 50)
+	v.SetDefault("DB_MAX_IDLE_CONNS", 25)
+	v.SetDefault("DB_CONN_MAX_LIFETIME", "30m")
+	v.SetDefault("DB_CONN_MAX_IDLE_TIME", "5m")
+	v.SetDefault("DB_REPLICAS", "")
+	v.SetDefault("DB_REPLICA_MAX_LAG", "2s")
+	v.SetDefault("DB_REPLICA_LAG_CHECK_INTERVAL", "1s")
+	v.SetDefault("BALANCE_STRATEGY", "pessimistic")
+	v.SetDefault("SINGLE_WRITER_ENABLED", false)
+	v.SetDefault("SINGLE_WRITER_SHARDS", 16)
+	v.SetDefault("SINGLE_WRITER_MAX_BATCH", 100)
+	v.SetDefault("SINGLE_WRITER_QUEUE_SIZE", 1000)
+	v.SetDefault("BALANCE_SHARDING_ENABLED", false)
+	v.SetDefault("BALANCE_SHARD_MAX", 64)
+	v.SetDefault("BALANCE_SHARD_REBALANCE_INTERVAL", "1m")
+	v.SetDefault("DB_RETRY_MAX_ATTEMPTS", 3)
+	v.SetDefault("DB_RETRY_BASE_DELAY", "20ms")
+	v.SetDefault("DB_RETRY_MAX_DELAY", "500ms")
+	v.SetDefault("ADJUSTMENT_TTL", "24h")
+	v.SetDefault("ADJUSTMENT_OPERATOR_KEYS", "")
+	v.SetDefault("ADJUSTMENT_APPROVAL_THRESHOLD", 0)
+	v.SetDefault("RATE_LIMIT_ENABLED", false)
+	v.SetDefault("RATE_LIMIT_IP_RATE", 50)
+	v.SetDefault("RATE_LIMIT_IP_BURST", 100)
+	v.SetDefault("RATE_LIMIT_API_KEY_RATE", 100)
+	v.SetDefault("RATE_LIMIT_API_KEY_BURST", 200)
+	v.SetDefault("RATE_LIMIT_USER_RATE", 20)
+	v.SetDefault("RATE_LIMIT_USER_BURST", 40)
+	v.SetDefault("ERROR_FORMAT", "default")
+	v.SetDefault("TRANSACTION_MAX_AMOUNT", 1000000000)
+	v.SetDefault("TRANSACTION_AMOUNT_PRECISION", 2)
+	v.SetDefault("HEALTH_DB_TIMEOUT", "2s")
+	v.SetDefault("SHUTDOWN_TIMEOUT", "30s")
+	v.SetDefault("SHUTDOWN_DRAIN_DELAY", "5s")
+	v.SetDefault("TRACING_EXPORTER", "none")
+	v.SetDefault("TRACING_SERVICE_NAME", "wyvern-api")
+	v.SetDefault("TRACING_OTLP_ENDPOINT", "localhost:4318")
+	v.SetDefault("TRACING_OTLP_INSECURE", true)
+	v.SetDefault("TRACING_FILE", "logs/traces.json")
+	v.SetDefault("TRACING_SAMPLE_RATIO", 1)
+	v.SetDefault("RUNTIME_SETTINGS_INTERVAL", "5s")
+	v.SetDefault("RUNTIME_SETTINGS_TABLE_ENABLED", false)
+	v.SetDefault("LOGGING_LEVEL", "debug")
+	v.SetDefault("LOGGING_FORMAT", "text")
+	v.SetDefault("LOGGING_FILE_NAME", "logs/app.log")
+	v.SetDefault("LOGGING_MAX_SIZE_MB", 100)
+	v.SetDefault("LOGGING_MAX_AGE_DAYS", 30)
+	v.SetDefault("LOGGING_MAX_BACKUPS", 10)
+	v.SetDefault("LOGGING_COMPRESS", false)
+	v.SetDefault("LOGGING_WRAPPER_CALLSTACK", true)
+}
+
+// Fingerprint short hash of the effective config, secret fields are left out.
+// Two replicas with the same fingerprint run with the same config.
+func Fingerprint() string {
+	if ENV == nil {
+		return ""
+	}
+
+	value := reflect.ValueOf(*ENV)
+	hash := sha256.New()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Tag.Get("secret") == "true" {
+			continue
+		}
+		fmt.Fprintf(hash, "%s=%v\n", field.Tag.Get("mapstructure"), value.Field(i).Interface())
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// Setting one effective config value
+type Setting struct {
+	Key   string
+	Value string
+}
+
+// secretMask shown instead of a secret
+const secretMask = "********"
+
+// Effective loaded config, the fields of Config then the other known keys sorted, e.g. LOGGING_*.
+// Secret fields, and other keys named like a secret, are masked.
+func Effective() []Setting {
+	if ENV == nil {
+		return nil
+	}
+
+	var effective []Setting
+	known := map[string]bool{}
+	value := reflect.ValueOf(*ENV)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		key := field.Tag.Get("mapstructure")
+		known[key] = true
+		effective = append(effective, Setting{Key: key, Value: mask(fmt.Sprint(value.Field(i).Interface()), field.Tag.Get("secret") == "true")})
+	}
 
-	if err := viper.ReadInConfig(); err != nil {
-		panic(err)
+	var others []string
+	for _, key := range settings().AllKeys() {
+		if key = strings.ToUpper(key); !known[key] {
+			others = append(others, key)
+		}
+	}
+	sort.Strings(others)
+	for _, key := range others {
+		secret := strings.Contains(key, "PASSWORD") || strings.Contains(key, "SECRET") || strings.Contains(key, "TOKEN")
+		effective = append(effective, Setting{Key: key, Value: mask(settings().GetString(key), secret)})
 	}
 
-	if err := viper.Unmarshal(&ENV); err != nil {
-		panic(err)
+	return effective
+}
+
+// mask value when it is a non-empty secret
+func mask(value string, secret bool) string {
+	if secret && value != "" {
+		return secretMask
 	}
+
+	return value
+}
+
+// settings viper of the loaded config, the global one before LoadConfig
+func settings() *viper.Viper {
+	if v := store.Load(); v != nil {
+		return v
+	}
+
+	return viper.GetViper()
 }
 
 // GetString get config string
 func GetString(key string, def ...string) string {
-	value := viper.GetString(key)
+	value := settings().GetString(key)
 
 	if value == "" && len(def) > 0 {
 		return def[0]
@@ -44,7 +454,7 @@ func GetString(key string, def ...string) string {
 
 // GetInt get config int
 func GetInt(key string, def ...int) int {
-	value := viper.GetInt(key)
+	value := settings().GetInt(key)
 
 	if value == 0 && len(def) > 0 {
 		return def[0]
@@ -55,7 +465,7 @@ func GetInt(key string, def ...int) int {
 
 // GetInt64 get config int64
 func GetInt64(key string, def ...int64) int64 {
-	value := viper.GetInt64(key)
+	value := settings().GetInt64(key)
 
 	if value == 0 && len(def) > 0 {
 		return def[0]
@@ -66,7 +476,7 @@ func GetInt64(key string, def ...int64) int64 {
 
 // GetFloat64 get config float64
 func GetFloat64(key string, def ...float64) float64 {
-	value := viper.GetFloat64(key)
+	value := settings().GetFloat64(key)
 
 	if value == 0 && len(def) > 0 {
 		return def[0]
@@ -77,11 +487,17 @@ func GetFloat64(key string, def ...float64) float64 {
 
 // GetBool get config bool
 func GetBool(key string, def ...bool) bool {
-	value := viper.GetBool(key)
+	value := settings().GetBool(key)
 
-	if len(def) > 0 {
+	// false is a configured value too, the default only applies to a key set nowhere
+	if !settings().IsSet(key) && len(def) > 0 {
 		return def[0]
 	}
 
 	return value
 }
+
+// TrustedProxyList IP or CIDR of each TRUSTED_PROXIES entry
+func (cfg *Config) TrustedProxyList() []string {
+	return splitAddresses(cfg.TrustedProxies)
+}
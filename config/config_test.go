@@ -0,0 +1,254 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile write content to name in dir, returning its path
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// chdir change the working directory to dir for the rest of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("layers override each other in order", func(t *testing.T) {
+		dir := t.TempDir()
+		password := writeFile(t, dir, "db_pw", "s3cret\n")
+		file := writeFile(t, dir, ".env", strings.Join([]string{
+			"PORT=1000",
+			"DB_URL=file-db",
+			"DB_PORT=3306",
+			"DB_USERNAME=root",
+			"DB_DATABASE=wyvern-api",
+			"DB_DEBUG=true",
+			"LOGGING_WRAPPER_CALLSTACK=false",
+		}, "\n"))
+		writeFile(t, dir, ".env.prod", "PORT=2000\nDB_PASSWORD=file:"+password)
+		t.Setenv("DB_URL", "env-db")
+
+		args, err := LoadConfig([]string{"-config", file, "-profile", "prod", "-set", "DB_PORT=3307", "migrate", "up"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(args, []string{"migrate", "up"}) {
+			t.Errorf("expected subcommand args, got %v", args)
+		}
+		checks := []struct {
+			key      string
+			got      any
+			expected any
+		}{
+			{"APP_PROFILE", ENV.Profile, ProfileProd},
+			{"DB_QUERY_TIMEOUT (default)", ENV.DbQueryTimeout, 5 * time.Second},
+			{"DB_USERNAME (file)", ENV.DbUsername, "root"},
+			{"DB_DEBUG (profile)", ENV.DbDebug, false},
+			{"PORT (profile file)", ENV.Port, "2000"},
+			{"DB_PASSWORD (profile file, file: secret)", ENV.DbPassword, "s3cret"},
+			{"DB_URL (environment)", ENV.DbURL, "env-db"},
+			{"DB_PORT (flag)", ENV.DbPort, "3307"},
+			{"LOGGING_WRAPPER_CALLSTACK (file, false)", GetBool("LOGGING_WRAPPER_CALLSTACK", true), false},
+		}
+		for _, c := range checks {
+			if c.got != c.expected {
+				t.Errorf("%s: expected %v, got %v", c.key, c.expected, c.got)
+			}
+		}
+	})
+
+	t.Run("missing default file", func(t *testing.T) {
+		chdir(t, t.TempDir())
+		if _, err := LoadConfig([]string{"-profile", "test"}); err != nil {
+			t.Fatal(err)
+		}
+		if ENV.DbDriver != "sqlite" || ENV.Port != "8080" {
+			t.Errorf("expected test profile and defaults, got driver %q, port %q", ENV.DbDriver, ENV.Port)
+		}
+	})
+
+	t.Run("missing given file", func(t *testing.T) {
+		if _, err := LoadConfig([]string{"-config", filepath.Join(t.TempDir(), ".env")}); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		if _, err := LoadConfig([]string{"-profile", "staging"}); err == nil || !strings.Contains(err.Error(), "APP_PROFILE") {
+			t.Errorf("expected APP_PROFILE error, got %v", err)
+		}
+	})
+
+	t.Run("every invalid value reported", func(t *testing.T) {
+		chdir(t, t.TempDir())
+		_, err := LoadConfig([]string{"-profile", "test", "-set", "PORT=http", "-set", "DB_DRIVER=oracle", "-set", "TRACING_SAMPLE_RATIO=2", "-set", "TRUSTED_PROXIES=10.0.0.0/8,lb"})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		for _, key := range []string{"PORT", "DB_DRIVER", "TRACING_SAMPLE_RATIO", "DB_URL", "TRUSTED_PROXIES"} {
+			if !strings.Contains(err.Error(), key+":") {
+				t.Errorf("expected %s in %q", key, err.Error())
+			}
+		}
+	})
+}
+
+func TestSubcommandArgs(t *testing.T) {
+	// the env file is not read, so a missing one or an undecryptable value does not matter
+	args, err := SubcommandArgs([]string{"-config", filepath.Join(t.TempDir(), ".env"), "-set", "PORT=1", "secrets", "keygen"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(args, []string{"secrets", "keygen"}) {
+		t.Errorf("expected subcommand args, got %v", args)
+	}
+
+	if _, err := SubcommandArgs([]string{"-set", "PORT"}); err == nil {
+		t.Error("expected error for invalid flag")
+	}
+}
+
+func TestEffective(t *testing.T) {
+	chdir(t, t.TempDir())
+	if _, err := LoadConfig([]string{"-profile", "test", "-set", "DB_PASSWORD=s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := map[string]string{}
+	for _, setting := range Effective() {
+		settings[setting.Key] = setting.Value
+	}
+	if settings["DB_PASSWORD"] != secretMask {
+		t.Errorf("expected masked password, got %q", settings["DB_PASSWORD"])
+	}
+	if settings["DB_DRIVER"] != "sqlite" || settings["LOGGING_LEVEL"] != "warn" {
+		t.Errorf("expected test profile values, got %q, %q", settings["DB_DRIVER"], settings["LOGGING_LEVEL"])
+	}
+}
+
+func TestGetBool(t *testing.T) {
+	v := viper.New()
+	v.Set("ENABLED", false)
+	store.Store(v)
+
+	if GetBool("ENABLED", true) {
+		t.Error("expected configured false over default")
+	}
+	if !GetBool("UNSET", true) {
+		t.Error("expected default for unset key")
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	base := "DB_DRIVER=sqlite\nDB_DATABASE=:memory:\n"
+	file := writeFile(t, dir, ".env", base+"LOGGING_LEVEL=info\nRATE_LIMIT_IP_RATE=50")
+	if _, err := LoadConfig([]string{"-config", file, "-profile", "dev"}); err != nil {
+		t.Fatal(err)
+	}
+	startup := ENV
+
+	var notified []Change
+	Subscribe(func(cfg *Config, changes []Change) { notified = changes })
+
+	t.Run("reloadable value from the file", func(t *testing.T) {
+		writeFile(t, dir, ".env", base+"LOGGING_LEVEL=warn\nRATE_LIMIT_IP_RATE=50")
+
+		changes, err := Reload(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []Change{{Key: "LOGGING_LEVEL", Old: "info", New: "warn"}}
+		if !slices.Equal(changes, expected) || !slices.Equal(notified, expected) {
+			t.Errorf("expected %v, got %v, notified %v", expected, changes, notified)
+		}
+		if Current().LoggingLevel != "warn" || ENV != startup {
+			t.Errorf("expected only Current swapped, got %q", Current().LoggingLevel)
+		}
+	})
+
+	t.Run("reloadable value from runtime settings", func(t *testing.T) {
+		if _, err := Reload(map[string]string{"rate_limit_ip_rate": "7"}); err != nil {
+			t.Fatal(err)
+		}
+		if Current().RateLimitIPRate != 7 {
+			t.Errorf("expected 7, got %v", Current().RateLimitIPRate)
+		}
+	})
+
+	t.Run("nothing changed", func(t *testing.T) {
+		notified = nil
+		changes, err := Reload(map[string]string{"RATE_LIMIT_IP_RATE": "7"})
+		if err != nil || len(changes) != 0 || notified != nil {
+			t.Errorf("expected no change, got %v, %v", changes, err)
+		}
+	})
+
+	t.Run("static value rejected", func(t *testing.T) {
+		before := Current()
+		writeFile(t, dir, ".env", base+"LOGGING_LEVEL=error\nPORT=9090")
+
+		_, err := Reload(nil)
+		if err == nil || !strings.Contains(err.Error(), "PORT: cannot change at runtime") {
+			t.Fatalf("expected PORT rejected, got %v", err)
+		}
+		if Current() != before {
+			t.Error("expected current config kept")
+		}
+	})
+
+	t.Run("static runtime setting rejected", func(t *testing.T) {
+		if _, err := Reload(map[string]string{"DB_URL": "elsewhere"}); err == nil || !strings.Contains(err.Error(), "DB_URL") {
+			t.Errorf("expected DB_URL rejected, got %v", err)
+		}
+	})
+
+	t.Run("invalid value rejected", func(t *testing.T) {
+		writeFile(t, dir, ".env", base+"LOGGING_LEVEL=loud")
+		if _, err := Reload(nil); err == nil || !strings.Contains(err.Error(), "LOGGING_LEVEL") {
+			t.Errorf("expected LOGGING_LEVEL rejected, got %v", err)
+		}
+	})
+}
+
+func TestParseOperatorKeys(t *testing.T) {
+	keys, err := parseOperatorKeys(" alice=alice-key-0123456789, bob = bob-key-0123456789 ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys["alice-key-0123456789"] != "alice" || keys["bob-key-0123456789"] != "bob" {
+		t.Errorf("expected alice and bob by key, got %v", keys)
+	}
+
+	for _, list := range []string{"alice", "=alice-key-0123456789", "alice=short", "alice=same-key-0123456789,bob=same-key-0123456789"} {
+		_, err := parseOperatorKeys(list)
+		if err == nil {
+			t.Errorf("%q: expected error", list)
+		} else if strings.Contains(err.Error(), "key-0123456789") || strings.Contains(err.Error(), "short") {
+			t.Errorf("%q: error shows a key: %v", list, err)
+		}
+	}
+}
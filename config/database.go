@@ -1,53 +1,98 @@
 package config
 
 import (
+	"errors"
 	"fmt"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"net"
+	"strings"
+	"wyvern-api/dialects"
 )
 
 // DB constant
 var DB *gorm.DB
 
+// ReplicaDBs read replicas of DB, one per DB_REPLICAS address, empty without replicas
+var ReplicaDBs []*gorm.DB
+
+// LoadDB open the DB_DRIVER database and its read replicas
 func LoadDB() {
-	// dsn := "user:pass@tcp(127.0.0.1:3306)/dbname?charset=utf8mb4&parseTime=True&loc=Local"
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", ENV.DbUsername, ENV.DbPassword, ENV.DbURL, ENV.DbPort, ENV.DbDatabase)
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	dialect, err := dialects.Get(ENV.DbDriver)
+	if err != nil {
+		panic(err)
+	}
+
+	DB = openDB(dialect, ENV.DbURL, ENV.DbPort)
+
+	for _, address := range ReplicaAddresses() {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			panic(fmt.Sprintf("invalid DB_REPLICAS address %q", address))
+		}
+		ReplicaDBs = append(ReplicaDBs, openDB(dialect, host, port))
+	}
+}
+
+// ReplicaAddresses host:port of each DB_REPLICAS entry
+func ReplicaAddresses() []string {
+	return splitAddresses(ENV.DbReplicas)
+}
+
+// splitAddresses non-empty entries of the comma separated list
+func splitAddresses(list string) []string {
+	var addresses []string
+	for _, address := range strings.Split(list, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses
+}
+
+// openDB open host:port with the DB_* credentials and pool settings
+func openDB(dialect dialects.Dialect, host string, port string) *gorm.DB {
+	db, err := gorm.Open(dialect.Dialector(dialects.Connection{
+		Host:     host,
+		Port:     port,
+		Username: ENV.DbUsername,
+		Password: ENV.DbPassword,
+		Database: ENV.DbDatabase,
+		SSLMode:  ENV.DbSSLMode,
+	}), &gorm.Config{})
 	if err != nil {
 		panic("failed to connect database")
 	}
 
-	DB = db
+	sqlDB, err := db.DB()
+	if err != nil {
+		panic("failed to connect database")
+	}
+	sqlDB.SetMaxOpenConns(ENV.DbMaxOpenConns)
+	sqlDB.SetMaxIdleConns(ENV.DbMaxIdleConns)
+	sqlDB.SetConnMaxLifetime(ENV.DbConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(ENV.DbConnMaxIdleTime)
+	// after the pool settings, a dialect may need to override them
+	dialect.Configure(sqlDB)
+
+	return db
 }
 
-//// LoadDB function for load database connection
-//func LoadDB() {
-//	aes := encryption.NewAes()
-//	dbPassword, err := aes.Decrypt(ENV.DbPassword)
-//	if err != nil {
-//		panic(err.Error())
-//	}
-//
-//	dbDebug := logger.Default.LogMode(logger.Info)
-//	if !ENV.DbDebug {
-//		dbDebug = nil
-//	}
-//
-//	connectionString := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Jakarta", ENV.DbURL, ENV.DbUsername, dbPassword, ENV.DbDatabase, ENV.DbPort)
-//	db, err := gorm.Open(postgres.New(postgres.Config{
-//		DSN:                  connectionString,
-//		PreferSimpleProtocol: true, // disables implicit prepared statement usage
-//	}), &gorm.Config{
-//		NamingStrategy: schema.NamingStrategy{
-//			TablePrefix:   fmt.Sprintf("%s.", ENV.DbSchema),
-//			SingularTable: false,
-//		},
-//		Logger: dbDebug,
-//	})
-//
-//	if err != nil {
-//		panic("failed to connect database")
-//	}
-//
-//	DB = db
-//}
+// CloseDB close database connection pool and the pools of the replicas
+func CloseDB() error {
+	var failed error
+	for _, db := range append([]*gorm.DB{DB}, ReplicaDBs...) {
+		if db == nil {
+			continue
+		}
+
+		sqlDB, err := db.DB()
+		if err != nil {
+			failed = errors.Join(failed, err)
+			continue
+		}
+		failed = errors.Join(failed, sqlDB.Close())
+	}
+
+	return failed
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MinOperatorKeyLength shortest key accepted in ADJUSTMENT_OPERATOR_KEYS
+const MinOperatorKeyLength = 16
+
+// OperatorKeys operator of each key of ADJUSTMENT_OPERATOR_KEYS, empty when no operator is configured
+func (cfg *Config) OperatorKeys() map[string]string {
+	keys, _ := parseOperatorKeys(cfg.AdjustmentOperatorKeys)
+	return keys
+}
+
+// parseOperatorKeys operator of each key in the comma separated operator=key list, the error never shows a key
+func parseOperatorKeys(list string) (map[string]string, error) {
+	keys := map[string]string{}
+	for i, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		operator, key, ok := strings.Cut(entry, "=")
+		operator, key = strings.TrimSpace(operator), strings.TrimSpace(key)
+		switch {
+		case !ok || operator == "":
+			return nil, fmt.Errorf("entry %d is not operator=key", i+1)
+		case len(key) < MinOperatorKeyLength:
+			return nil, fmt.Errorf("key of %s must have at least %d characters", operator, MinOperatorKeyLength)
+		}
+		if other, exists := keys[key]; exists {
+			return nil, fmt.Errorf("%s and %s share a key", other, operator)
+		}
+		keys[key] = operator
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"sort"
+)
+
+// Profile names for APP_PROFILE
+const (
+	ProfileDev  = "dev"
+	ProfileTest = "test"
+	ProfileProd = "prod"
+)
+
+// profiles values of each profile, they override the env file and are overridden by the env file of the profile,
+// environment variables and flags
+var profiles = map[string]map[string]any{
+	ProfileDev: {},
+	ProfileTest: {
+		"DB_DRIVER":     "sqlite",
+		"DB_DATABASE":   ":memory:",
+		"DB_DEBUG":      false,
+		"LOGGING_LEVEL": "warn",
+	},
+	ProfileProd: {
+		"DB_DEBUG":                  false,
+		"LOGGING_LEVEL":             "info",
+		"LOGGING_FORMAT":            "json",
+		"LOGGING_WRAPPER_CALLSTACK": false,
+	},
+}
+
+// profileNames sorted names of the profiles
+func profileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
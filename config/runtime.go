@@ -0,0 +1,142 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// store viper of the current config
+var store atomic.Pointer[viper.Viper]
+
+// current config, swapped by Reload
+var current atomic.Pointer[Config]
+
+// reloader what Reload needs of LoadConfig, one reload at a time
+var reloader struct {
+	mu          sync.Mutex
+	args        []string
+	files       []string
+	subscribers []func(cfg *Config, changes []Change)
+}
+
+// Change one config value changed by Reload, secrets masked
+type Change struct {
+	Key string
+	Old string
+	New string
+}
+
+// Current latest config. Fields tagged reload may change at runtime, read them through Current instead of ENV;
+// every other field stays as loaded on startup.
+func Current() *Config {
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+
+	return ENV
+}
+
+// Files env files of the loaded config, including the env file of the profile which may not exist yet
+func Files() []string {
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+
+	return append([]string(nil), reloader.files...)
+}
+
+// Reloadable whether the config field of key may change at runtime
+func Reloadable(key string) bool {
+	field, ok := fieldByKey(strings.ToUpper(key))
+	return ok && field.Tag.Get("reload") == "true"
+}
+
+// Subscribe call fn after every reload that changed a value, with the new config and what changed
+func Subscribe(fn func(cfg *Config, changes []Change)) {
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+
+	reloader.subscribers = append(reloader.subscribers, fn)
+}
+
+// Reload load the config again with the args of LoadConfig, runtime overriding every other layer, e.g. the values
+// of a settings table. The new config is validated and swapped in only when nothing but reloadable values changed,
+// otherwise the current config stays and every rejected key is reported. It returns what changed.
+func Reload(runtime map[string]string) ([]Change, error) {
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+
+	var p problems
+	overrides := make(map[string]string, len(runtime))
+	for key, value := range runtime {
+		key = strings.ToUpper(key)
+		if !Reloadable(key) {
+			p.add(key, "cannot change at runtime")
+			continue
+		}
+		overrides[key] = value
+	}
+	if len(p) > 0 {
+		return nil, fmt.Errorf("config not reloaded:\n%w", errors.Join(p...))
+	}
+
+	result, err := load(reloader.args, overrides)
+	if err != nil {
+		return nil, fmt.Errorf("config not reloaded: %w", err)
+	}
+
+	changes := diff(Current(), result.cfg)
+	for _, change := range changes {
+		if !Reloadable(change.Key) {
+			p.add(change.Key, "cannot change at runtime, restart to apply")
+		}
+	}
+	if len(p) > 0 {
+		return nil, fmt.Errorf("config not reloaded:\n%w", errors.Join(p...))
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	store.Store(result.v)
+	current.Store(result.cfg)
+	for _, fn := range reloader.subscribers {
+		fn(result.cfg, changes)
+	}
+
+	return changes, nil
+}
+
+// diff values of new that differ from old
+func diff(old *Config, new *Config) []Change {
+	var changes []Change
+	oldValue, newValue := reflect.ValueOf(*old), reflect.ValueOf(*new)
+	for i := 0; i < oldValue.NumField(); i++ {
+		field := oldValue.Type().Field(i)
+		before, after := fmt.Sprint(oldValue.Field(i).Interface()), fmt.Sprint(newValue.Field(i).Interface())
+		if before == after {
+			continue
+		}
+
+		secret := field.Tag.Get("secret") == "true"
+		changes = append(changes, Change{Key: field.Tag.Get("mapstructure"), Old: mask(before, secret), New: mask(after, secret)})
+	}
+
+	return changes
+}
+
+// fieldByKey Config field of the mapstructure key
+func fieldByKey(key string) (reflect.StructField, bool) {
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		if field := configType.Field(i); field.Tag.Get("mapstructure") == key {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
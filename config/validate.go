@@ -0,0 +1,171 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"wyvern-api/dialects"
+)
+
+// problems invalid config values, by key
+type problems []error
+
+// add record a problem of key
+func (p *problems) add(key string, format string, args ...any) {
+	*p = append(*p, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+// required record key when value is empty
+func (p *problems) required(key string, value string) {
+	if strings.TrimSpace(value) == "" {
+		p.add(key, "required")
+	}
+}
+
+// oneOf record key when value is not one of allowed
+func (p *problems) oneOf(key string, value string, allowed ...string) {
+	if !slices.Contains(allowed, value) {
+		p.add(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+	}
+}
+
+// positive record key when value is not above 0
+func (p *problems) positive(key string, value float64) {
+	if value <= 0 {
+		p.add(key, "must be greater than 0, got %v", value)
+	}
+}
+
+// notNegative record key when value is below 0
+func (p *problems) notNegative(key string, value float64) {
+	if value < 0 {
+		p.add(key, "must not be negative, got %v", value)
+	}
+}
+
+// positiveDuration record key when d is not above 0
+func (p *problems) positiveDuration(key string, d time.Duration) {
+	if d <= 0 {
+		p.add(key, "must be a duration greater than 0, e.g. \"5s\", got %q", d)
+	}
+}
+
+// notNegativeDuration record key when d is below 0
+func (p *problems) notNegativeDuration(key string, d time.Duration) {
+	if d < 0 {
+		p.add(key, "must not be a negative duration, got %q", d)
+	}
+}
+
+// Validate check cfg, every invalid value is reported, one per line, with its key
+func Validate(cfg *Config) error {
+	var p problems
+
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port < 1 || port > 65535 {
+		p.add("PORT", "must be a port number, got %q", cfg.Port)
+	}
+	for _, proxy := range splitAddresses(cfg.TrustedProxies) {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			p.add("TRUSTED_PROXIES", "%q is not an IP or CIDR", proxy)
+		}
+	}
+
+	if _, err := dialects.Get(cfg.DbDriver); err != nil {
+		p.oneOf("DB_DRIVER", cfg.DbDriver, dialects.DriverMySQL, dialects.DriverPostgres, dialects.DriverSQLite)
+	}
+	p.required("DB_DATABASE", cfg.DbDatabase)
+	if cfg.DbDriver != dialects.DriverSQLite {
+		p.required("DB_URL", cfg.DbURL)
+		p.required("DB_PORT", cfg.DbPort)
+		p.required("DB_USERNAME", cfg.DbUsername)
+	}
+	if cfg.Profile == ProfileProd {
+		if cfg.DbDriver == dialects.DriverSQLite {
+			p.add("DB_DRIVER", "sqlite is for tests and local runs, not the %s profile", ProfileProd)
+		}
+		p.required("DB_PASSWORD", cfg.DbPassword)
+	}
+
+	p.positiveDuration("DB_TRANSACTION_TIMEOUT", cfg.DbTransactionTimeout)
+	p.positiveDuration("DB_QUERY_TIMEOUT", cfg.DbQueryTimeout)
+	p.positiveDuration("DB_LOCK_WAIT_TIMEOUT", cfg.DbLockWaitTimeout)
+	p.positiveDuration("DB_MIGRATION_LOCK_TIMEOUT", cfg.DbMigrationLockTimeout)
+
+	p.notNegative("DB_MAX_OPEN_CONNS", float64(cfg.DbMaxOpenConns))
+	p.notNegative("DB_MAX_IDLE_CONNS", float64(cfg.DbMaxIdleConns))
+	if cfg.DbMaxOpenConns > 0 && cfg.DbMaxIdleConns > cfg.DbMaxOpenConns {
+		p.add("DB_MAX_IDLE_CONNS", "must not be above DB_MAX_OPEN_CONNS (%d), got %d", cfg.DbMaxOpenConns, cfg.DbMaxIdleConns)
+	}
+	p.notNegativeDuration("DB_CONN_MAX_LIFETIME", cfg.DbConnMaxLifetime)
+	p.notNegativeDuration("DB_CONN_MAX_IDLE_TIME", cfg.DbConnMaxIdleTime)
+
+	for _, address := range splitAddresses(cfg.DbReplicas) {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			p.add("DB_REPLICAS", "%q is not host:port", address)
+		}
+	}
+	if cfg.DbReplicas != "" {
+		p.positiveDuration("DB_REPLICA_MAX_LAG", cfg.DbReplicaMaxLag)
+		p.positiveDuration("DB_REPLICA_LAG_CHECK_INTERVAL", cfg.DbReplicaLagCheckInterval)
+	}
+
+	// names of services.NewBalanceStrategy
+	p.oneOf("BALANCE_STRATEGY", cfg.BalanceStrategy, "pessimistic", "optimistic")
+	if cfg.SingleWriterEnabled {
+		p.positive("SINGLE_WRITER_SHARDS", float64(cfg.SingleWriterShards))
+		p.positive("SINGLE_WRITER_MAX_BATCH", float64(cfg.SingleWriterMaxBatch))
+		p.positive("SINGLE_WRITER_QUEUE_SIZE", float64(cfg.SingleWriterQueueSize))
+	}
+	if cfg.BalanceShardingEnabled {
+		p.positive("BALANCE_SHARD_MAX", float64(cfg.BalanceShardMax))
+		p.notNegativeDuration("BALANCE_SHARD_REBALANCE_INTERVAL", cfg.BalanceShardRebalanceInterval)
+	}
+
+	p.positive("DB_RETRY_MAX_ATTEMPTS", float64(cfg.DbRetryMaxAttempts))
+	p.notNegativeDuration("DB_RETRY_BASE_DELAY", cfg.DbRetryBaseDelay)
+	if cfg.DbRetryMaxDelay < cfg.DbRetryBaseDelay {
+		p.add("DB_RETRY_MAX_DELAY", "must not be below DB_RETRY_BASE_DELAY (%s), got %s", cfg.DbRetryBaseDelay, cfg.DbRetryMaxDelay)
+	}
+
+	p.positiveDuration("ADJUSTMENT_TTL", cfg.AdjustmentTTL)
+	if _, err := parseOperatorKeys(cfg.AdjustmentOperatorKeys); err != nil {
+		p.add("ADJUSTMENT_OPERATOR_KEYS", "%s", err.Error())
+	}
+	p.notNegative("ADJUSTMENT_APPROVAL_THRESHOLD", cfg.AdjustmentApprovalThreshold)
+
+	if cfg.RateLimitEnabled {
+		p.positive("RATE_LIMIT_IP_RATE", cfg.RateLimitIPRate)
+		p.positive("RATE_LIMIT_IP_BURST", float64(cfg.RateLimitIPBurst))
+		p.positive("RATE_LIMIT_API_KEY_RATE", cfg.RateLimitAPIKeyRate)
+		p.positive("RATE_LIMIT_API_KEY_BURST", float64(cfg.RateLimitAPIKeyBurst))
+		p.positive("RATE_LIMIT_USER_RATE", cfg.RateLimitUserRate)
+		p.positive("RATE_LIMIT_USER_BURST", float64(cfg.RateLimitUserBurst))
+	}
+
+	p.oneOf("ERROR_FORMAT", cfg.ErrorFormat, "default", "problem")
+
+	p.positive("TRANSACTION_MAX_AMOUNT", cfg.TransactionMaxAmount)
+	if cfg.TransactionAmountPrecision < 0 || cfg.TransactionAmountPrecision > 8 {
+		p.add("TRANSACTION_AMOUNT_PRECISION", "must be between 0 and 8, got %d", cfg.TransactionAmountPrecision)
+	}
+
+	p.positiveDuration("HEALTH_DB_TIMEOUT", cfg.HealthDBTimeout)
+	p.positiveDuration("SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout)
+	p.notNegativeDuration("SHUTDOWN_DRAIN_DELAY", cfg.ShutdownDrainDelay)
+
+	p.oneOf("TRACING_EXPORTER", cfg.TracingExporter, "none", "otlp", "stdout", "file")
+	if cfg.TracingSampleRatio < 0 || cfg.TracingSampleRatio > 1 {
+		p.add("TRACING_SAMPLE_RATIO", "must be between 0 and 1, got %v", cfg.TracingSampleRatio)
+	}
+
+	p.notNegativeDuration("RUNTIME_SETTINGS_INTERVAL", cfg.RuntimeSettingsInterval)
+
+	p.oneOf("LOGGING_LEVEL", cfg.LoggingLevel, "trace", "debug", "info", "warn", "error", "fatal", "panic")
+	p.oneOf("LOGGING_FORMAT", cfg.LoggingFormat, "text", "json")
+
+	return errors.Join(p...)
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"wyvern-api/models"
+	"wyvern-api/utils"
+	"wyvern-api/validators"
+)
+
+// AdjustmentService what AdjustmentController needs, implemented by services.AdjustmentService
+type AdjustmentService interface {
+	Propose(ctx context.Context, operator string, req models.ProposeAdjustmentRequest) (models.Adjustment, error)
+	Approve(ctx context.Context, ID int64, operator string, req models.ReviewAdjustmentRequest) (models.Adjustment, error)
+	Reject(ctx context.Context, ID int64, operator string, req models.ReviewAdjustmentRequest) (models.Adjustment, error)
+	Get(ctx context.Context, ID int64) (models.Adjustment, error)
+	List(ctx context.Context, filter models.AdjustmentFilter) ([]models.Adjustment, error)
+}
+
+type AdjustmentController struct {
+	svc AdjustmentService
+}
+
+// NewAdjustmentController initiate AdjustmentController
+func NewAdjustmentController(svc AdjustmentService) *AdjustmentController {
+	return &AdjustmentController{
+		svc: svc,
+	}
+}
+
+// Propose is method to create a pending credit/debit adjustment
+func (c *AdjustmentController) Propose(ctx *gin.Context) {
+	log := utils.NewLoggerFromContext(ctx.Request.Context(), "Propose", 0).Controller().Start()
+
+	var req models.ProposeAdjustmentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		log.Warn("bad request, error: %s", err.Error())
+		log.End()
+		utils.ResponseError(ctx, validators.BindError(err))
+		return
+	}
+
+	response, err := c.svc.Propose(ctx.Request.Context(), utils.OperatorFromContext(ctx.Request.Context()), req)
+	if err != nil {
+		log.Warn("failed propose adjustment, error: %s", err.Error())
+		log.End()
+		utils.ResponseError(ctx, err)
+		return
+	}
+
+	log.End()
+	utils.ResponseSuccess(ctx, response)
+}
+
+// Approve is method to approve and execute a pending adjustment
+func (c *AdjustmentController) Approve(ctx *gin.Context) {
+	log := utils.NewLoggerFromContext(ctx.Request.Context(), "Approve", 0).Controller().Start()
+
+	ID, req, ok := bindReview(ctx)
+	if !ok {
+		log.Warn("bad request")
+		log.End()
+		return
+	}
+
+	response, err := c.svc.Approve(ctx.Request.Context(), ID, utils.OperatorFromContext(ctx.Request.Context()), req)
+	if err != nil {
+		log.Warn("failed approve adjustment, error: %s", err.Error())
+		log.End()
+		utils.ResponseError(ctx, err)
+		return
+	}
+
+	log.End()
+	utils.ResponseSuccess(ctx, response)
+}
+
+// Reject is method to reject a pending adjustment
+func (c *AdjustmentController) Reject(ctx *gin.Context) {
+	log := utils.NewLoggerFromContext(ctx.Request.Context(), "Reject", 0).Controller().Start()
+
+	ID, req, ok := bindReview(ctx)
+	if !ok {
+		log.Warn("bad request")
+		log.End()
+		return
+	}
+
+	response, err := c.svc.Reject(ctx.Request.Context(), ID, utils.OperatorFromContext(ctx.Request.Context()), req)
+	if err != nil {
+		log.Warn("failed reject adjustment, error: %s", err.Error())
+		log.End()
+		utils.ResponseError(ctx, err)
+		return
+	}
+
+	log.End()
+	utils.ResponseSuccess(ctx, response)
+}
+
+// Get is method to show an adjustment
+func (c *AdjustmentController) Get(ctx *gin.Context) {
+	log := utils.NewLoggerFromContext(ctx.Request.Context(), "Get", 0).Controller().Start()
+
+	ID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		log.Warn("bad request, error: %s", err.Error())
+		log.End()
+		utils.ResponseError(ctx, models.ErrInvalidRequest.WithMessage("Invalid id"))
+		return
+	}
+
+	response, err := c.svc.Get(ctx.Request.Context(), ID)
+	if err != nil {
+		log.Warn("failed get adjustment, error: %s", err.Error())
+		log.End()
+		utils.ResponseError(ctx, err)
+		return
+	}
+
+	log.End()
+	utils.ResponseSuccess(ctx, response)
+}
+
+// List is method to query adjustment history
+func (c *AdjustmentController) List(ctx *gin.Context) {
+	log := utils.NewLoggerFromContext(ctx.Request.Context(), "List", 0).Controller().Start()
+
+	var filter models.AdjustmentFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		log.Warn("bad request, error: %s", err.Error())
+		log.End()
+		utils.ResponseError(ctx, validators.BindError(err))
+		return
+	}
+
+	response, err := c.svc.List(ctx.Request.Context(), filter)
+	if err != nil {
+		log.Warn("failed list adjustment, error: %s", err.Error())
+		log.End()
+		utils.ResponseError(ctx, err)
+		return
+	}
+
+	log.End()
+	utils.ResponseSuccess(ctx, response)
+}
+
+// bindReview bind adjustment id and review request, write bad request response when invalid
+func bindReview(ctx *gin.Context) (int64, models.ReviewAdjustmentRequest, bool) {
+	var req models.ReviewAdjustmentRequest
+	ID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		utils.ResponseError(ctx, models.ErrInvalidRequest.WithMessage("Invalid id"))
+		return ID, req, false
+	}
+
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			utils.ResponseError(ctx, validators.BindError(err))
+			return ID, req, false
+		}
+	}
+
+	return ID, req, true
+}
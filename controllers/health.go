@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"wyvern-api/models"
+	"wyvern-api/utils"
+)
+
+// HealthService what HealthController needs, implemented by services.HealthService
+type HealthService interface {
+	Readiness(ctx context.Context) (models.HealthReport, bool)
+	Status(ctx context.Context) models.StatusReport
+}
+
+type HealthController struct {
+	health HealthService
+}
+
+// NewHealthController initiate HealthController
+func NewHealthController(health HealthService) *HealthController {
+	return &HealthController{
+		health: health,
+	}
+}
+
+// Liveness is method to tell the process is alive, it never touches dependencies
+func (c *HealthController) Liveness(ctx *gin.Context) {
+	utils.ResponseSuccess(ctx, models.HealthReport{Status: models.HealthStatusOK})
+}
+
+// Readiness is method to tell the process can serve traffic
+func (c *HealthController) Readiness(ctx *gin.Context) {
+	report, ready := c.health.Readiness(ctx.Request.Context())
+	if !ready {
+		resp := models.ResponseV2{
+			Code:      models.ErrNotReady.Status,
+			Status:    "error",
+			Message:   models.ErrNotReady.Message,
+			ErrorCode: models.ErrNotReady.Code,
+			RequestID: utils.RequestIDFromContext(ctx.Request.Context()),
+			Data:      report,
+		}
+		ctx.JSON(resp.Code, resp)
+		return
+	}
+
+	utils.ResponseSuccess(ctx, report)
+}
+
+// Status is method to show build, uptime, pool and config details for operators
+func (c *HealthController) Status(ctx *gin.Context) {
+	utils.ResponseSuccess(ctx, c.health.Status(ctx.Request.Context()))
+}
@@ -1,74 +1,99 @@
 package controllers
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
-	"net/http"
-	"time"
-	"wyvern-api/config"
 	"wyvern-api/models"
-	"wyvern-api/repositories"
-	"wyvern-api/services"
 	"wyvern-api/utils"
+	"wyvern-api/validators"
 )
 
+// TransactionService what TransactionController needs, implemented by services.TransactionService
+type TransactionService interface {
+	Credit(ctx context.Context, req models.CreditRequest) (models.CreditResponse, error)
+	Debit(ctx context.Context, req models.DebitRequest) (models.DebitResponse, error)
+	History(ctx context.Context, filter models.TransactionFilter) ([]models.Transaction, error)
+}
+
 type TransactionController struct {
+	svc TransactionService
 }
 
 // NewTransactionController initiate TransactionController
-func NewTransactionController() *TransactionController {
-	return &TransactionController{}
+func NewTransactionController(svc TransactionService) *TransactionController {
+	return &TransactionController{
+		svc: svc,
+	}
 }
 
 // Credit is method to increase user balance
 func (c *TransactionController) Credit(ctx *gin.Context) {
-	identifier := time.Now().UnixNano()
-	log := utils.NewLoggerIdentifier("Credit", 0, identifier).Controller().Start()
+	log := utils.NewLoggerFromContext(ctx.Request.Context(), "Credit", 0).Controller().Start()
 
 	var req models.CreditRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		log.Warn("bad request, error: %s", err.Error())
 		log.End()
-		resp := models.ResponseV2{
-			Code:    http.StatusBadRequest,
-			Status:  "error",
-			Message: "Invalid amount",
-		}
-		ctx.JSON(resp.Code, resp)
+		utils.ResponseError(ctx, validators.BindError(err))
 		return
 	}
 
-	db := config.DB
-	transactionRepo := repositories.NewTransactionRepo(db)
-	svc := services.NewTransactionService(transactionRepo, db, identifier)
-	response := svc.Credit(req)
+	response, err := c.svc.Credit(ctx.Request.Context(), req)
+	if err != nil {
+		log.Warn("failed credit, error: %s", err.Error())
+		log.End()
+		utils.ResponseError(ctx, err)
+		return
+	}
 
 	log.End()
-	ctx.JSON(http.StatusOK, response)
+	utils.ResponseSuccess(ctx, response)
 }
 
 // Debit is method to deduct user balance
 func (c *TransactionController) Debit(ctx *gin.Context) {
-	identifier := time.Now().UnixNano()
-	log := utils.NewLoggerIdentifier("Debit", 0, identifier).Controller().Start()
+	log := utils.NewLoggerFromContext(ctx.Request.Context(), "Debit", 0).Controller().Start()
 
 	var req models.DebitRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		log.Warn("bad request, error: %s", err.Error())
 		log.End()
-		resp := models.ResponseV2{
-			Code:    http.StatusBadRequest,
-			Status:  "error",
-			Message: "Invalid amount",
-		}
-		ctx.JSON(resp.Code, resp)
+		utils.ResponseError(ctx, validators.BindError(err))
+		return
+	}
+
+	response, err := c.svc.Debit(ctx.Request.Context(), req)
+	if err != nil {
+		log.Warn("failed debit, error: %s", err.Error())
+		log.End()
+		utils.ResponseError(ctx, err)
+		return
+	}
+
+	log.End()
+	utils.ResponseSuccess(ctx, response)
+}
+
+// History is method to query transaction history by user, reference, category or metadata
+func (c *TransactionController) History(ctx *gin.Context) {
+	log := utils.NewLoggerFromContext(ctx.Request.Context(), "History", 0).Controller().Start()
+
+	var filter models.TransactionFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		log.Warn("bad request, error: %s", err.Error())
+		log.End()
+		utils.ResponseError(ctx, validators.BindError(err))
 		return
 	}
 
-	db := config.DB
-	transactionRepo := repositories.NewTransactionRepo(db)
-	svc := services.NewTransactionService(transactionRepo, db, identifier)
-	response := svc.Debit(req)
+	response, err := c.svc.History(ctx.Request.Context(), filter)
+	if err != nil {
+		log.Warn("failed history, error: %s", err.Error())
+		log.End()
+		utils.ResponseError(ctx, err)
+		return
+	}
 
 	log.End()
-	ctx.JSON(http.StatusOK, response)
+	utils.ResponseSuccess(ctx, response)
 }
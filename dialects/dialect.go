@@ -0,0 +1,108 @@
+package dialects
+
+import (
+	"database/sql"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Driver names for DB_DRIVER
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// ErrorKind database failure independent of the driver
+type ErrorKind int
+
+// ErrorKind values
+const (
+	ErrorOther ErrorKind = iota
+	ErrorDeadlock
+	ErrorLockWaitTimeout
+	ErrorUniqueViolation
+)
+
+// Connection where to connect, Database is the file for SQLite
+type Connection struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	Database string
+	SSLMode  string
+}
+
+// Dialect what differs between the supported databases
+type Dialect interface {
+	// Name of the driver, matches the name of its gorm.Dialector
+	Name() string
+	// Dialector to open conn with
+	Dialector(conn Connection) gorm.Dialector
+	// Configure adjust the pool after open
+	Configure(sqlDB *sql.DB)
+	// Lock add a row lock of strength ("UPDATE" or "SHARE") to the select of db, skipLocked leaves out rows locked by others
+	Lock(db *gorm.DB, strength string, skipLocked bool) *gorm.DB
+	// Classify kind of err, ErrorOther when it is not an error of this driver
+	Classify(err error) ErrorKind
+	// AcquireLock take the named lock for the session of conn, false when it is still held by another after timeout
+	AcquireLock(conn *gorm.DB, name string, timeout time.Duration) (bool, error)
+	// ReleaseLock release the named lock taken by AcquireLock
+	ReleaseLock(conn *gorm.DB, name string) error
+	// ReplicationLag how far the replica db is behind its primary, an error when it is not replicating
+	ReplicationLag(db *gorm.DB) (time.Duration, error)
+	// TransactionalDDL whether schema changes in a transaction roll back with it
+	TransactionalDDL() bool
+}
+
+var dialects = map[string]Dialect{
+	DriverMySQL:    mysqlDialect{},
+	DriverPostgres: postgresDialect{},
+	DriverSQLite:   sqliteDialect{},
+}
+
+// Get Dialect of driver
+func Get(driver string) (Dialect, error) {
+	if dialect, ok := dialects[driver]; ok {
+		return dialect, nil
+	}
+
+	return nil, fmt.Errorf("unknown DB_DRIVER %q", driver)
+}
+
+// For Dialect of the connection of db, MySQL when the dialector is not one of ours
+func For(db *gorm.DB) Dialect {
+	if dialect, ok := dialects[db.Dialector.Name()]; ok {
+		return dialect
+	}
+
+	return dialects[DriverMySQL]
+}
+
+// Lock scope locking the selected rows until the transaction ends, see Dialect.Lock
+func Lock(strength string, skipLocked bool) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return For(db).Lock(db, strength, skipLocked)
+	}
+}
+
+// Classify kind of err whatever driver returned it
+func Classify(err error) ErrorKind {
+	if err == nil {
+		return ErrorOther
+	}
+	for _, dialect := range dialects {
+		if kind := dialect.Classify(err); kind != ErrorOther {
+			return kind
+		}
+	}
+
+	return ErrorOther
+}
+
+// IsUniqueViolation check whether err is a duplicate key on a unique index or primary key
+func IsUniqueViolation(err error) bool {
+	return Classify(err) == ErrorUniqueViolation
+}
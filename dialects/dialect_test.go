@@ -0,0 +1,88 @@
+package dialects
+
+import (
+	"errors"
+	"fmt"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"strings"
+	"testing"
+)
+
+type row struct {
+	ID int64
+}
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		kind ErrorKind
+	}{
+		{"mysql deadlock", &mysqlDriver.MySQLError{Number: 1213}, ErrorDeadlock},
+		{"mysql lock wait timeout", &mysqlDriver.MySQLError{Number: 1205}, ErrorLockWaitTimeout},
+		{"mysql duplicate entry", &mysqlDriver.MySQLError{Number: 1062}, ErrorUniqueViolation},
+		{"mysql other", &mysqlDriver.MySQLError{Number: 1146}, ErrorOther},
+		{"postgres deadlock", &pgconn.PgError{Code: "40P01"}, ErrorDeadlock},
+		{"postgres lock not available", &pgconn.PgError{Code: "55P03"}, ErrorLockWaitTimeout},
+		{"postgres unique violation", fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505"}), ErrorUniqueViolation},
+		{"other", errors.New("boom"), ErrorOther},
+		{"nil", nil, ErrorOther},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if kind := Classify(c.err); kind != c.kind {
+				t.Errorf("expected %d, got %d", c.kind, kind)
+			}
+		})
+	}
+}
+
+func TestLock(t *testing.T) {
+	sqlite, _ := Get(DriverSQLite)
+	cases := []struct {
+		name       string
+		dialector  gorm.Dialector
+		skipLocked bool
+		expected   string
+	}{
+		{"mysql", mysql.New(mysql.Config{DSN: "user@tcp(127.0.0.1:3306)/db", SkipInitializeWithVersion: true}), false, "FOR UPDATE"},
+		{"mysql skip locked", mysql.New(mysql.Config{DSN: "user@tcp(127.0.0.1:3306)/db", SkipInitializeWithVersion: true}), true, "FOR UPDATE SKIP LOCKED"},
+		{"postgres skip locked", postgres.Open("host=127.0.0.1 user=user dbname=db"), true, "FOR UPDATE SKIP LOCKED"},
+		{"sqlite", sqlite.Dialector(Connection{Database: ":memory:"}), true, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db, err := gorm.Open(c.dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			statement := db.Scopes(Lock("UPDATE", c.skipLocked)).Find(&[]row{}).Statement
+			query := statement.SQL.String()
+			if c.expected == "" && strings.Contains(query, "FOR ") {
+				t.Errorf("expected no lock clause, got %q", query)
+			}
+			if c.expected != "" && !strings.HasSuffix(query, c.expected) {
+				t.Errorf("expected %q to end with %q", query, c.expected)
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	for _, driver := range []string{DriverMySQL, DriverPostgres, DriverSQLite} {
+		dialect, err := Get(driver)
+		if err != nil || dialect.Name() != driver {
+			t.Errorf("expected %s dialect, got %v, %v", driver, dialect, err)
+		}
+	}
+	if _, err := Get("oracle"); err == nil {
+		t.Error("expected error for unknown driver")
+	}
+}
@@ -0,0 +1,137 @@
+package dialects
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strconv"
+	"time"
+)
+
+// MySQL error numbers
+const (
+	mysqlErrDuplicateEntry  uint16 = 1062
+	mysqlErrLockWaitTimeout uint16 = 1205
+	mysqlErrDeadlock        uint16 = 1213
+)
+
+// mysqlDialect MySQL 8, SKIP LOCKED and FOR SHARE need it
+type mysqlDialect struct{}
+
+// Name implement Dialect
+func (mysqlDialect) Name() string {
+	return DriverMySQL
+}
+
+// Dialector implement Dialect
+func (mysqlDialect) Dialector(conn Connection) gorm.Dialector {
+	// dsn := "user:pass@tcp(127.0.0.1:3306)/dbname?charset=utf8mb4&parseTime=True&loc=Local"
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", conn.Username, conn.Password, conn.Host, conn.Port, conn.Database)
+	return mysql.Open(dsn)
+}
+
+// Configure implement Dialect
+func (mysqlDialect) Configure(*sql.DB) {}
+
+// Lock implement Dialect
+func (mysqlDialect) Lock(db *gorm.DB, strength string, skipLocked bool) *gorm.DB {
+	return db.Clauses(lockingClause(strength, skipLocked))
+}
+
+// Classify implement Dialect
+func (mysqlDialect) Classify(err error) ErrorKind {
+	var mysqlErr *mysqlDriver.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return ErrorOther
+	}
+
+	switch mysqlErr.Number {
+	case mysqlErrDeadlock:
+		return ErrorDeadlock
+	case mysqlErrLockWaitTimeout:
+		return ErrorLockWaitTimeout
+	case mysqlErrDuplicateEntry:
+		return ErrorUniqueViolation
+	}
+
+	return ErrorOther
+}
+
+// AcquireLock implement Dialect with GET_LOCK, released when the session ends at the latest
+func (mysqlDialect) AcquireLock(conn *gorm.DB, name string, timeout time.Duration) (bool, error) {
+	var acquired sql.NullInt64
+	if err := conn.Raw("SELECT GET_LOCK(?, ?)", name, int(timeout.Seconds())).Scan(&acquired).Error; err != nil {
+		return false, err
+	}
+
+	return acquired.Valid && acquired.Int64 == 1, nil
+}
+
+// ReleaseLock implement Dialect
+func (mysqlDialect) ReleaseLock(conn *gorm.DB, name string) error {
+	return conn.Exec("SELECT RELEASE_LOCK(?)", name).Error
+}
+
+// TransactionalDDL implement Dialect, MySQL commits each DDL statement on its own
+func (mysqlDialect) TransactionalDDL() bool {
+	return false
+}
+
+// lockingClause FOR UPDATE/FOR SHARE, optionally SKIP LOCKED, as MySQL and PostgreSQL write it
+func lockingClause(strength string, skipLocked bool) clause.Locking {
+	locking := clause.Locking{Strength: strength}
+	if skipLocked {
+		locking.Options = "SKIP LOCKED"
+	}
+
+	return locking
+}
+
+// ReplicationLag implement Dialect with Seconds_Behind_Source of SHOW REPLICA STATUS, MySQL 8.0.22 or later
+func (mysqlDialect) ReplicationLag(db *gorm.DB) (time.Duration, error) {
+	rows, err := db.Raw("SHOW REPLICA STATUS").Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("not a replica")
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+
+	for i, column := range columns {
+		if column != "Seconds_Behind_Source" {
+			continue
+		}
+		// NULL while the replication threads are stopped
+		if values[i] == nil {
+			return 0, errors.New("replication is stopped")
+		}
+		seconds, err := strconv.ParseInt(string(values[i]), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	return 0, errors.New("no Seconds_Behind_Source in SHOW REPLICA STATUS")
+}
@@ -0,0 +1,121 @@
+package dialects
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"hash/fnv"
+	"time"
+)
+
+// PostgreSQL error codes
+const (
+	pgErrUniqueViolation  = "23505"
+	pgErrDeadlockDetected = "40P01"
+	pgErrLockNotAvailable = "55P03"
+)
+
+// pgAdvisoryLockInterval wait between two tries of a held advisory lock
+const pgAdvisoryLockInterval = 200 * time.Millisecond
+
+// postgresDialect PostgreSQL 9.5 or later
+type postgresDialect struct{}
+
+// Name implement Dialect
+func (postgresDialect) Name() string {
+	return DriverPostgres
+}
+
+// Dialector implement Dialect
+func (postgresDialect) Dialector(conn Connection) gorm.Dialector {
+	sslMode := conn.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s", conn.Host, conn.Username, conn.Password, conn.Database, conn.Port, sslMode)
+	return postgres.Open(dsn)
+}
+
+// Configure implement Dialect
+func (postgresDialect) Configure(*sql.DB) {}
+
+// Lock implement Dialect
+func (postgresDialect) Lock(db *gorm.DB, strength string, skipLocked bool) *gorm.DB {
+	return db.Clauses(lockingClause(strength, skipLocked))
+}
+
+// Classify implement Dialect
+func (postgresDialect) Classify(err error) ErrorKind {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return ErrorOther
+	}
+
+	switch pgErr.Code {
+	case pgErrDeadlockDetected:
+		return ErrorDeadlock
+	case pgErrLockNotAvailable:
+		return ErrorLockWaitTimeout
+	case pgErrUniqueViolation:
+		return ErrorUniqueViolation
+	}
+
+	return ErrorOther
+}
+
+// AcquireLock implement Dialect with a session advisory lock keyed by the hash of name, polled until timeout
+func (postgresDialect) AcquireLock(conn *gorm.DB, name string, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var acquired bool
+		if err := conn.Raw("SELECT pg_try_advisory_lock(?)", advisoryKey(name)).Scan(&acquired).Error; err != nil {
+			return false, err
+		}
+		if acquired || time.Now().After(deadline) {
+			return acquired, nil
+		}
+		time.Sleep(pgAdvisoryLockInterval)
+	}
+}
+
+// ReleaseLock implement Dialect
+func (postgresDialect) ReleaseLock(conn *gorm.DB, name string) error {
+	return conn.Exec("SELECT pg_advisory_unlock(?)", advisoryKey(name)).Error
+}
+
+// advisoryKey bigint key of the named lock
+func advisoryKey(name string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(name))
+	return int64(hash.Sum64())
+}
+
+// ReplicationLag implement Dialect with the age of the last replayed transaction.
+// It grows while the primary has nothing to replicate, keep the primary busy or the lag limit loose.
+func (postgresDialect) ReplicationLag(db *gorm.DB) (time.Duration, error) {
+	var status struct {
+		InRecovery bool
+		Lag        sql.NullFloat64
+	}
+	err := db.Raw("SELECT pg_is_in_recovery() AS in_recovery, " +
+		"EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()) AS lag").Scan(&status).Error
+	if err != nil {
+		return 0, err
+	}
+	if !status.InRecovery {
+		return 0, errors.New("not a replica")
+	}
+	if !status.Lag.Valid {
+		return 0, errors.New("nothing replayed yet")
+	}
+
+	return time.Duration(status.Lag.Float64 * float64(time.Second)), nil
+}
+
+// TransactionalDDL implement Dialect
+func (postgresDialect) TransactionalDDL() bool {
+	return true
+}
@@ -0,0 +1,87 @@
+package dialects
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	sqliteDriver "github.com/glebarez/go-sqlite"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"time"
+)
+
+// SQLite result codes
+const (
+	sqliteBusy                 = 5
+	sqliteLocked               = 6
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintUnique     = 2067
+	sqliteBusyTimeout          = 5 * time.Second
+)
+
+// sqliteDialect SQLite, pure Go, meant for tests and local runs.
+// It has no row locks, transactions begin IMMEDIATE and take the write lock of the whole database instead,
+// and the pool keeps one connection so an in-memory database is shared and writers queue in-process.
+type sqliteDialect struct{}
+
+// Name implement Dialect
+func (sqliteDialect) Name() string {
+	return DriverSQLite
+}
+
+// Dialector implement Dialect, Database is a file path or ":memory:"
+func (sqliteDialect) Dialector(conn Connection) gorm.Dialector {
+	dsn := fmt.Sprintf("file:%s?_txlock=immediate&_pragma=busy_timeout(%d)", conn.Database, sqliteBusyTimeout.Milliseconds())
+	return sqlite.Open(dsn)
+}
+
+// Configure implement Dialect
+func (sqliteDialect) Configure(sqlDB *sql.DB) {
+	sqlDB.SetMaxOpenConns(1)
+	// an in-memory database lives as long as its connection
+	sqlDB.SetConnMaxIdleTime(0)
+	sqlDB.SetConnMaxLifetime(0)
+}
+
+// Lock implement Dialect, the IMMEDIATE transaction already excludes other writers
+func (sqliteDialect) Lock(db *gorm.DB, _ string, _ bool) *gorm.DB {
+	return db
+}
+
+// Classify implement Dialect
+func (sqliteDialect) Classify(err error) ErrorKind {
+	var sqliteErr *sqliteDriver.Error
+	if !errors.As(err, &sqliteErr) {
+		return ErrorOther
+	}
+
+	switch code := sqliteErr.Code(); {
+	case code == sqliteConstraintUnique || code == sqliteConstraintPrimaryKey:
+		return ErrorUniqueViolation
+	case code&0xff == sqliteBusy || code&0xff == sqliteLocked:
+		return ErrorLockWaitTimeout
+	}
+
+	return ErrorOther
+}
+
+// AcquireLock implement Dialect, the single connection already keeps migrations of this process apart
+// and another process waits on the database write lock
+func (sqliteDialect) AcquireLock(*gorm.DB, string, time.Duration) (bool, error) {
+	return true, nil
+}
+
+// ReleaseLock implement Dialect
+func (sqliteDialect) ReleaseLock(*gorm.DB, string) error {
+	return nil
+}
+
+// ReplicationLag implement Dialect, SQLite has no replication
+func (sqliteDialect) ReplicationLag(*gorm.DB) (time.Duration, error) {
+	return 0, errors.New("sqlite has no replicas")
+}
+
+// TransactionalDDL implement Dialect
+func (sqliteDialect) TransactionalDDL() bool {
+	return true
+}
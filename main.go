@@ -1,18 +1,161 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"wyvern-api/app"
+	"wyvern-api/commands"
 	"wyvern-api/config"
+	"wyvern-api/metrics"
+	"wyvern-api/migrations"
 	"wyvern-api/routers"
+	"wyvern-api/services"
+	"wyvern-api/tracing"
+	"wyvern-api/utils"
+	"wyvern-api/validators"
 )
 
 func main() {
-	config.LoadConfig() // load config files
-	config.LoadDB()     // initiate database connection
+	// flags, e.g. -profile prod -set PORT=9090, come before the admin subcommand
+	args, err := config.SubcommandArgs(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	// "secrets" manages the keys the config is decrypted with, it must work when an enc: value can not be
+	if commands.Standalone(args) {
+		if err := commands.Run(context.Background(), args); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if _, err := config.LoadConfig(os.Args[1:]); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	utils.InitLogger()                  // open log file
+	validators.Register(config.Current) // register custom request validations
+
+	log := utils.NewLogger("Main", 0)
+
+	// admin subcommand, e.g. "wyvern-api migrate up", runs instead of the server and connects the database itself
+	if len(args) > 0 {
+		err := commands.Run(context.Background(), args)
+		_ = config.CloseDB()
+		_ = utils.CloseLogger()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	config.LoadDB() // initiate database connection
+
+	// refuse to serve on a schema older than this build
+	migrator, err := migrations.New(config.DB, config.ENV.DbMigrationLockTimeout)
+	if err != nil {
+		panic(err)
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		panic(err)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	if err := config.DB.Use(tracing.NewGormPlugin()); err != nil {
+		panic(err)
+	}
+	replicaDBs := map[string]*gorm.DB{}
+	for i, address := range config.ReplicaAddresses() {
+		if err := config.ReplicaDBs[i].Use(tracing.NewGormPlugin()); err != nil {
+			panic(err)
+		}
+		replicaDBs[address] = config.ReplicaDBs[i]
+	}
+	if err := metrics.RegisterDB(config.DB); err != nil {
+		log.Warn("failed register db pool metrics, error: %s", err.Error())
+	}
+
+	// repositories and services are built once here, controllers get them through routers.Routes
+	a, err := app.New(config.ENV, config.DB, replicaDBs)
+	if err != nil {
+		panic(err)
+	}
+	a.Start()
 
 	r := gin.Default()
-	routers.Routes(r) // added all routes
+	routers.Routes(r, a.RouterServices()) // added all routes
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%s", config.ENV.Port),
+		Handler: r,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Info("listening on %s", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("failed serve, error: %s", err.Error())
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	stop() // a second signal kills the process right away
+
+	shutdown(srv, a.Services.Health, a.Workers, shutdownTracing, log)
+}
+
+// shutdown drain in-flight requests and background workers, then flush traces and release db and log file
+func shutdown(srv *http.Server, health *services.HealthService, workers *utils.Workers, shutdownTracing func(context.Context) error, log *utils.Logger) {
+	log.Info("shutting down, draining for %s", config.ENV.ShutdownDrainDelay)
+
+	// fail readiness first, so no new traffic is routed here while we still serve
+	health.SetDraining()
+	time.Sleep(config.ENV.ShutdownDrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ENV.ShutdownTimeout)
+	defer cancel()
+
+	// stop accepting and wait for in-flight handlers, so no transaction is cut mid-way
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Error("failed drain in-flight requests, error: %s", err.Error())
+	}
+
+	if err := workers.Stop(ctx); err != nil {
+		log.Error("failed stop background workers, error: %s", err.Error())
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error("failed flush traces, error: %s", err.Error())
+	}
+
+	if err := config.CloseDB(); err != nil {
+		log.Error("failed close database, error: %s", err.Error())
+	}
 
-	r.Run(fmt.Sprintf(":%s", config.ENV.Port))
+	log.Info("shutdown complete")
+	if err := utils.CloseLogger(); err != nil {
+		fmt.Printf("failed close log file, error: %s\n", err.Error())
+	}
 }
@@ -0,0 +1,183 @@
+// Package metrics holds the prometheus collectors exposed on /metrics.
+//
+// Metric names and labels are part of the public contract of the service, dashboards and alerts depend on them.
+// Add new metrics freely, but never rename a metric or change its labels, add a new one and deprecate the old one.
+package metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+	"time"
+	"wyvern-api/models"
+)
+
+// Namespace prefix of every metric
+const Namespace = "wyvern"
+
+// Outcome label of a successful transaction, failed transactions use the error code
+const OutcomeSuccess = "success"
+
+// Registry registry served on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts requests by method, route template and status
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes request latency by method, route template and status
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// Transactions counts credit/debit by type and outcome
+	Transactions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "transactions_total",
+		Help:      "Credit/debit transactions by type and outcome (success or error code).",
+	}, []string{"type", "outcome"})
+
+	// TransactionAmount sums credit/debit amount by type and outcome
+	TransactionAmount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "transaction_amount_total",
+		Help:      "Sum of credit/debit amount by type and outcome (success or error code).",
+	}, []string{"type", "outcome"})
+
+	// DBTransactionDuration observes time from begin to commit/rollback, by the TxRunner
+	DBTransactionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "db_transaction_duration_seconds",
+		Help:      "Database transaction duration from begin to commit or rollback, by type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type"})
+
+	// DBLockWait observes time spent waiting for the user row lock
+	DBLockWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "db_lock_wait_seconds",
+		Help:      "Time spent acquiring the user row lock (SELECT ... FOR UPDATE), by type.",
+		Buckets:   []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"type"})
+
+	// DBRollbacks counts rolled back transactions by reason
+	DBRollbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "db_rollbacks_total",
+		Help:      "Rolled back database transactions by reason.",
+	}, []string{"reason"})
+
+	// WriterBatchSize observes credits/debits committed together by a single writer worker
+	WriterBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "writer_batch_size",
+		Help:      "Credits/debits committed in one transaction by a single writer worker.",
+		Buckets:   []float64{1, 2, 5, 10, 20, 50, 100, 200, 500},
+	})
+
+	// DBRetries counts database transactions re-run after a retryable error
+	DBRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "db_retries_total",
+		Help:      "Database transactions re-run after a deadlock or lock wait timeout, by reason.",
+	}, []string{"reason"})
+
+	// DBReplicaLag last measured lag of each read replica, -1 when it could not be measured
+	DBReplicaLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "db_replica_lag_seconds",
+		Help:      "Replication lag of each read replica, -1 when it could not be measured.",
+	}, []string{"replica"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		Transactions,
+		TransactionAmount,
+		DBTransactionDuration,
+		DBLockWait,
+		DBRollbacks,
+		DBRetries,
+		WriterBatchSize,
+		DBReplicaLag,
+	)
+}
+
+// RegisterDB expose sql.DB pool gauges as go_sql_* with db_name="wyvern"
+func RegisterDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	err = Registry.Register(collectors.NewDBStatsCollector(sqlDB, Namespace))
+	var already prometheus.AlreadyRegisteredError
+	if errors.As(err, &already) {
+		return nil
+	}
+
+	return err
+}
+
+// ObserveTransaction record outcome and amount of a credit/debit
+func ObserveTransaction(txType string, amount float64, err error) {
+	outcome := Outcome(err)
+	Transactions.WithLabelValues(txType, outcome).Inc()
+	TransactionAmount.WithLabelValues(txType, outcome).Add(amount)
+}
+
+// ObserveDBTransaction record time from begin of a database transaction to its commit/rollback
+func ObserveDBTransaction(txType string, begin time.Time) {
+	DBTransactionDuration.WithLabelValues(txType).Observe(time.Since(begin).Seconds())
+}
+
+// ObserveLockWait record time spent acquiring a row lock
+func ObserveLockWait(txType string, start time.Time) {
+	DBLockWait.WithLabelValues(txType).Observe(time.Since(start).Seconds())
+}
+
+// Rollback count a rollback, reason is a short snake_case cause
+func Rollback(reason string) {
+	DBRollbacks.WithLabelValues(reason).Inc()
+}
+
+// Retry count a re-run transaction, reason is a short snake_case cause
+func Retry(reason string) {
+	DBRetries.WithLabelValues(reason).Inc()
+}
+
+// Outcome label value of err
+func Outcome(err error) string {
+	if err == nil {
+		return OutcomeSuccess
+	}
+
+	return models.AsAppError(err).Code
+}
+
+// ObserveWriterBatch record size of a single writer batch
+func ObserveWriterBatch(size int) {
+	WriterBatchSize.Observe(float64(size))
+}
+
+// ObserveReplicaLag record lag of replica, negative when unknown
+func ObserveReplicaLag(replica string, lag time.Duration) {
+	if lag < 0 {
+		DBReplicaLag.WithLabelValues(replica).Set(-1)
+		return
+	}
+
+	DBReplicaLag.WithLabelValues(replica).Set(lag.Seconds())
+}
@@ -0,0 +1,14 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"wyvern-api/utils"
+)
+
+// ErrorFormat store the configured ERROR_FORMAT in the request context, utils.ResponseError writes errors in it
+func ErrorFormat(format string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Request = ctx.Request.WithContext(utils.ContextWithErrorFormat(ctx.Request.Context(), format))
+		ctx.Next()
+	}
+}
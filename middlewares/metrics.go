@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"time"
+	"wyvern-api/metrics"
+)
+
+// Metrics count requests and observe latency by route template, so path params do not explode label values
+func Metrics() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(ctx.Writer.Status())
+
+		metrics.HTTPRequests.WithLabelValues(ctx.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(ctx.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"wyvern-api/models"
+	"wyvern-api/utils"
+)
+
+// OperatorKeyHeader header carrying the key of the operator who propose or review an adjustment
+const OperatorKeyHeader = "X-Operator-Key"
+
+// Operator authenticate the operator by its key, keys maps each key to its operator. The operator is stored in
+// the request context, a missing or unknown key is answered with 401 and never reaches the handler.
+func Operator(keys map[string]string) gin.HandlerFunc {
+	// compare digests, so the time taken tells nothing about the length or prefix of a key
+	digests := make(map[[sha256.Size]byte]string, len(keys))
+	for key, operator := range keys {
+		digests[sha256.Sum256([]byte(key))] = operator
+	}
+
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(OperatorKeyHeader)
+		digest := sha256.Sum256([]byte(key))
+
+		operator := ""
+		for candidate, name := range digests {
+			if subtle.ConstantTimeCompare(digest[:], candidate[:]) == 1 {
+				operator = name
+			}
+		}
+		if key == "" || operator == "" {
+			log := utils.NewLoggerFromContext(ctx.Request.Context(), "Operator", 0)
+			log.Warn("operator key missing or unknown")
+			utils.ResponseError(ctx, models.ErrOperatorUnauthorized)
+			return
+		}
+
+		ctx.Request = ctx.Request.WithContext(utils.ContextWithOperator(ctx.Request.Context(), operator))
+		ctx.Next()
+	}
+}
@@ -0,0 +1,151 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"wyvern-api/config"
+	"wyvern-api/models"
+	"wyvern-api/utils"
+)
+
+// APIKeyHeader header carrying client api key
+const APIKeyHeader = "X-API-Key"
+
+// RateLimitMaxBody largest request body on a rate limited route, the user rule reads it before the handler does
+const RateLimitMaxBody = 64 << 10
+
+// RateLimitRule struct one dimension of rate limit, Key return "" when the rule does not apply
+type RateLimitRule struct {
+	Name  string
+	Limit RateLimit
+	Key   func(ctx *gin.Context) string
+}
+
+// DefaultRateLimitRules build rate limit rules by api key, user id and ip from the current config,
+// RATE_LIMIT_* rates and bursts may change at runtime
+func DefaultRateLimitRules() []RateLimitRule {
+	cfg := config.Current()
+	rules := []RateLimitRule{
+		{
+			Name:  "api_key",
+			Limit: RateLimit{Rate: cfg.RateLimitAPIKeyRate, Burst: cfg.RateLimitAPIKeyBurst},
+			Key:   func(ctx *gin.Context) string { return ctx.GetHeader(APIKeyHeader) },
+		},
+		{
+			Name:  "user",
+			Limit: RateLimit{Rate: cfg.RateLimitUserRate, Burst: cfg.RateLimitUserBurst},
+			Key:   userIDFromBody,
+		},
+		{
+			Name:  "ip",
+			Limit: RateLimit{Rate: cfg.RateLimitIPRate, Burst: cfg.RateLimitIPBurst},
+			Key:   func(ctx *gin.Context) string { return ctx.ClientIP() },
+		},
+	}
+
+	var enabled []RateLimitRule
+	for _, rule := range rules {
+		if rule.Limit.Rate > 0 && rule.Limit.Burst > 0 {
+			enabled = append(enabled, rule)
+		}
+	}
+
+	return enabled
+}
+
+// RateLimiter token bucket rate limit middleware, a request must get a token from every rule and takes none
+// when any rule rejects it. rules is called per request, so it can follow config changes
+func RateLimiter(store RateLimitStore, rules func() []RateLimitRule) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		// the user rule reads the body before any limit applies, so it is bounded first
+		if err := limitBody(ctx); err != nil {
+			utils.ResponseError(ctx, models.ErrPayloadTooLarge)
+			return
+		}
+
+		var buckets []RateLimitBucket
+		for _, rule := range rules() {
+			if key := rule.Key(ctx); key != "" {
+				buckets = append(buckets, RateLimitBucket{Key: fmt.Sprintf("%s:%s", rule.Name, key), Limit: rule.Limit})
+			}
+		}
+		if len(buckets) == 0 {
+			ctx.Next()
+			return
+		}
+
+		results, err := store.TakeAll(buckets, time.Now())
+		if err != nil {
+			// fail open, a broken store must not take the api down
+			log := utils.NewLoggerFromContext(ctx.Request.Context(), "RateLimiter", 0)
+			log.Warn("failed take rate limit token, error: %s", err.Error())
+			ctx.Next()
+			return
+		}
+
+		// headers of the bucket that rejected the request, else of the one closest to empty
+		tightest := results[0]
+		for _, result := range results[1:] {
+			if tightest.Allowed && (!result.Allowed || result.Remaining < tightest.Remaining) {
+				tightest = result
+			}
+		}
+
+		ctx.Header("X-RateLimit-Limit", strconv.Itoa(tightest.Limit))
+		ctx.Header("X-RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+		ctx.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(tightest.ResetAfter)))
+
+		if !tightest.Allowed {
+			ctx.Header("Retry-After", strconv.Itoa(ceilSeconds(tightest.RetryAfter)))
+			utils.ResponseError(ctx, models.ErrRateLimited)
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// limitBody read the body, at most RateLimitMaxBody bytes, and put it back for the rules and the handler
+func limitBody(ctx *gin.Context) error {
+	if ctx.Request.Body == nil || ctx.Request.Body == http.NoBody {
+		return nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, RateLimitMaxBody))
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return err
+}
+
+// userIDFromBody read user_id from the json body bounded by limitBody and put the body back for the handler
+func userIDFromBody(ctx *gin.Context) string {
+	if ctx.Request.Body == nil || ctx.Request.Method == http.MethodGet {
+		return ""
+	}
+
+	body, err := io.ReadAll(ctx.Request.Body)
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		UserID int64 `json:"user_id"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.UserID == 0 {
+		return ""
+	}
+
+	return strconv.FormatInt(payload.UserID, 10)
+}
+
+// ceilSeconds round duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,134 @@
+package middlewares
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit struct token bucket setting, Rate is token refilled per second
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitResult struct result of taking a token
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	ResetAfter time.Duration
+}
+
+// RateLimitBucket struct one bucket a request takes a token from
+type RateLimitBucket struct {
+	Key   string
+	Limit RateLimit
+}
+
+// RateLimitStore interface keep token bucket state, implement it on a shared store
+// (e.g. redis, in one script) to limit across replicas
+type RateLimitStore interface {
+	// TakeAll take one token from every bucket when each of them has one, otherwise take none, so a request
+	// rejected by one bucket costs nothing in the others. Allowed of each result tells whether that bucket had one.
+	TakeAll(buckets []RateLimitBucket, now time.Time) ([]RateLimitResult, error)
+}
+
+// bucket struct token bucket state
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  RateLimit
+}
+
+// MemoryRateLimitStore struct in-process RateLimitStore
+type MemoryRateLimitStore struct {
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	takes    int
+	sweepGap int
+}
+
+// NewMemoryRateLimitStore initiate MemoryRateLimitStore
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:  make(map[string]*bucket),
+		sweepGap: 10000,
+	}
+}
+
+// Take is method to take one token from bucket key
+func (store *MemoryRateLimitStore) Take(key string, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	results, err := store.TakeAll([]RateLimitBucket{{Key: key, Limit: limit}}, now)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	return results[0], nil
+}
+
+// TakeAll implement RateLimitStore
+func (store *MemoryRateLimitStore) TakeAll(buckets []RateLimitBucket, now time.Time) ([]RateLimitResult, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	states := make([]*bucket, len(buckets))
+	allowed := true
+	for i, rb := range buckets {
+		burst := float64(rb.Limit.Burst)
+		b, ok := store.buckets[rb.Key]
+		if !ok {
+			b = &bucket{tokens: burst, last: now}
+			store.buckets[rb.Key] = b
+		}
+		b.limit = rb.Limit
+
+		// refill
+		elapsed := now.Sub(b.last).Seconds()
+		if elapsed > 0 {
+			b.tokens = math.Min(burst, b.tokens+elapsed*rb.Limit.Rate)
+			b.last = now
+		}
+
+		states[i] = b
+		allowed = allowed && b.tokens >= 1
+	}
+
+	results := make([]RateLimitResult, len(buckets))
+	for i, b := range states {
+		result := RateLimitResult{Limit: b.limit.Burst, Allowed: b.tokens >= 1}
+		if allowed {
+			b.tokens--
+		}
+		if !result.Allowed {
+			result.RetryAfter = secondsToDuration((1 - b.tokens) / b.limit.Rate)
+		}
+		result.Remaining = int(b.tokens)
+		result.ResetAfter = secondsToDuration((float64(b.limit.Burst) - b.tokens) / b.limit.Rate)
+		results[i] = result
+	}
+
+	store.takes++
+	if store.takes >= store.sweepGap {
+		store.sweep(now)
+	}
+
+	return results, nil
+}
+
+// sweep remove buckets that are full again, they are the same as a new bucket
+func (store *MemoryRateLimitStore) sweep(now time.Time) {
+	store.takes = 0
+	for key, b := range store.buckets {
+		refilled := b.tokens + now.Sub(b.last).Seconds()*b.limit.Rate
+		if refilled >= float64(b.limit.Burst) {
+			delete(store.buckets, key)
+		}
+	}
+}
+
+// secondsToDuration convert seconds to time.Duration
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
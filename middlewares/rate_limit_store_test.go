@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStore_Take(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	limit := RateLimit{Rate: 2, Burst: 3}
+	now := time.Now()
+
+	// burst is available immediately
+	for i := 0; i < limit.Burst; i++ {
+		result, err := store.Take("user:1", limit, now)
+		if err != nil {
+			t.Fatalf("Take failed: %v", err)
+		}
+		if !result.Allowed {
+			t.Fatalf("Take %d: expected allowed", i)
+		}
+		if result.Remaining != limit.Burst-i-1 {
+			t.Errorf("Take %d: expected remaining %d, got %d", i, limit.Burst-i-1, result.Remaining)
+		}
+	}
+
+	// bucket is empty, next token comes in 1/rate second
+	result, _ := store.Take("user:1", limit, now)
+	if result.Allowed {
+		t.Fatalf("expected denied after burst")
+	}
+	if result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("expected retry after 500ms, got %s", result.RetryAfter)
+	}
+
+	// other keys have their own bucket
+	if result, _ := store.Take("user:2", limit, now); !result.Allowed {
+		t.Errorf("expected other key allowed")
+	}
+
+	// refilled after waiting
+	if result, _ := store.Take("user:1", limit, now.Add(500*time.Millisecond)); !result.Allowed {
+		t.Errorf("expected allowed after refill")
+	}
+}
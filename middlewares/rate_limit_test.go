@@ -0,0 +1,116 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newRateLimitedRouter router with one POST route behind RateLimiter of rules
+func newRateLimitedRouter(store RateLimitStore, rules ...RateLimitRule) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/", RateLimiter(store, func() []RateLimitRule { return rules }), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	return router
+}
+
+func post(router *gin.Engine, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestRateLimiter(t *testing.T) {
+	apiKey := RateLimitRule{
+		Name:  "api_key",
+		Limit: RateLimit{Rate: 1, Burst: 2},
+		Key:   func(ctx *gin.Context) string { return ctx.GetHeader(APIKeyHeader) },
+	}
+	user := RateLimitRule{Name: "user", Limit: RateLimit{Rate: 1, Burst: 1}, Key: userIDFromBody}
+
+	t.Run("headers and 429 when a bucket is empty", func(t *testing.T) {
+		router := newRateLimitedRouter(NewMemoryRateLimitStore(), apiKey)
+
+		for i, remaining := range []string{"1", "0"} {
+			w := post(router, "{}", APIKeyHeader, "k")
+			if w.Code != http.StatusOK {
+				t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+			}
+			if w.Header().Get("X-RateLimit-Limit") != "2" || w.Header().Get("X-RateLimit-Remaining") != remaining {
+				t.Errorf("request %d: expected limit 2 and remaining %s, got %v", i, remaining, w.Header())
+			}
+			if w.Header().Get("X-RateLimit-Reset") == "" {
+				t.Errorf("request %d: expected X-RateLimit-Reset", i)
+			}
+		}
+
+		w := post(router, "{}", APIKeyHeader, "k")
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected 429, got %d", w.Code)
+		}
+		if w.Header().Get("Retry-After") != "1" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+			t.Errorf("expected Retry-After 1 and remaining 0, got %v", w.Header())
+		}
+		if !strings.Contains(w.Body.String(), "RATE_LIMITED") {
+			t.Errorf("expected RATE_LIMITED, got %s", w.Body.String())
+		}
+	})
+
+	t.Run("rejection by one rule takes no token from the others", func(t *testing.T) {
+		store := NewMemoryRateLimitStore()
+		router := newRateLimitedRouter(store, apiKey, user)
+
+		if w := post(router, `{"user_id":1}`, APIKeyHeader, "k"); w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		for i := 0; i < 3; i++ {
+			if w := post(router, `{"user_id":1}`, APIKeyHeader, "k"); w.Code != http.StatusTooManyRequests {
+				t.Fatalf("expected 429 from the user rule, got %d", w.Code)
+			}
+		}
+
+		// the api key bucket still holds the token the rejected requests did not use
+		result, _ := store.Take("api_key:k", apiKey.Limit, time.Now())
+		if !result.Allowed {
+			t.Errorf("expected api key token left, got %+v", result)
+		}
+	})
+
+	t.Run("handler gets the body the user rule read", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		var got string
+		router.POST("/", RateLimiter(NewMemoryRateLimitStore(), func() []RateLimitRule { return []RateLimitRule{user} }), func(ctx *gin.Context) {
+			body, _ := ctx.GetRawData()
+			got = string(body)
+		})
+
+		post(router, `{"user_id":7}`)
+		if got != `{"user_id":7}` {
+			t.Errorf("expected body passed on, got %q", got)
+		}
+	})
+
+	t.Run("oversized body is refused before any rule", func(t *testing.T) {
+		router := newRateLimitedRouter(NewMemoryRateLimitStore(), user)
+
+		w := post(router, `{"user_id":1,"pad":"`+strings.Repeat("x", RateLimitMaxBody)+`"}`)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected 413, got %d", w.Code)
+		}
+		if w.Header().Get("X-RateLimit-Limit") != "" {
+			t.Errorf("expected no rate limit headers, got %v", w.Header())
+		}
+	})
+}
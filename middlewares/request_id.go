@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"regexp"
+	"wyvern-api/utils"
+)
+
+// RequestIDHeader header carrying the request id in and out
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID accepted incoming request id, anything else is replaced so it can not break log lines
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID take request id from the gateway or generate one, store it in the request context and echo it back
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = utils.NewRequestID()
+		}
+
+		reqCtx := utils.ContextWithRequestID(ctx.Request.Context(), requestID)
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		ctx.Header(RequestIDHeader, requestID)
+		trace.SpanFromContext(reqCtx).SetAttributes(attribute.String("request.id", requestID))
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"net/http"
+)
+
+// untracedPaths probe and scrape endpoints, tracing them is only noise
+var untracedPaths = map[string]bool{
+	"/metrics": true,
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// Tracing start a server span of service per request, continuing the trace of an incoming W3C traceparent header
+func Tracing(service string) gin.HandlerFunc {
+	return otelgin.Middleware(service, otelgin.WithFilter(func(r *http.Request) bool {
+		return !untracedPaths[r.URL.Path]
+	}))
+}
+
+// TraceResponse write traceparent of the request span on the response, so clients can report it
+func TraceResponse() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		otel.GetTextMapPropagator().Inject(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Writer.Header()))
+		ctx.Next()
+	}
+}
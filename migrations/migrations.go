@@ -0,0 +1,370 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"wyvern-api/dialects"
+	"wyvern-api/utils"
+)
+
+// files migrations of each dialect in sql/<driver>, same versions and names in every dialect
+//
+//go:embed sql/*/*.sql
+var files embed.FS
+
+// lockName named lock held while migrating, so two replicas never migrate at once
+const lockName = "wyvern-api:migrate"
+
+// ErrLocked another process is migrating
+var ErrLocked = errors.New("migration lock is held by another process")
+
+// fileName <version>_<name>.<up|down>.sql
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration one schema version, Up applies it and Down reverts it
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status of one Migration, AppliedAt is nil while it is pending
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// schemaMigration struct schema_migrations table, one row per applied version
+type schemaMigration struct {
+	Version   int64     `gorm:"column:version;primaryKey"`
+	Name      string    `gorm:"column:name"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+// TableName table of schemaMigration
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator struct, applies the embedded migrations to db
+type Migrator struct {
+	db          *gorm.DB
+	dialect     dialects.Dialect
+	migrations  []Migration
+	lockTimeout time.Duration
+}
+
+// New initiate Migrator with the embedded migrations of the dialect of db, waiting at most lockTimeout for the migration lock
+func New(db *gorm.DB, lockTimeout time.Duration) (*Migrator, error) {
+	dialect := dialects.For(db)
+	migrations, err := load(files, path.Join("sql", dialect.Name()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:          db,
+		dialect:     dialect,
+		migrations:  migrations,
+		lockTimeout: lockTimeout,
+	}, nil
+}
+
+// Latest version of the embedded migrations, 0 when there is none
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status is method to list every embedded migration and when it was applied. It only reads, every migration is
+// pending while schema_migrations does not exist yet
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(m.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = Status{Version: migration.Version, Name: migration.Name}
+		if at, ok := applied[migration.Version]; ok {
+			at := at
+			statuses[i].AppliedAt = &at
+		}
+	}
+
+	return statuses, nil
+}
+
+// Check is method to return an error when an embedded migration is not applied yet. It only reads, so readiness
+// probes can call it with a database user that can not change the schema.
+// Versions applied by a newer build are accepted, so a rolling deploy can run old and new side by side.
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, fmt.Sprintf("%04d_%s", status.Version, status.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is behind, pending migrations: %s, run \"migrate up\"", strings.Join(pending, ", "))
+	}
+
+	return nil
+}
+
+// Up is method to apply every pending migration
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down is method to revert the latest applied migration
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].Version]; ok {
+				return m.revert(ctx, conn, m.migrations[i])
+			}
+		}
+		return nil
+	})
+}
+
+// To is method to apply or revert migrations until the schema is at version, 0 reverts everything
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version != 0 && m.find(version) < 0 {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+
+		// revert newer versions first, newest first
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; ok && migration.Version > version {
+				if err := m.revert(ctx, conn, migration); err != nil {
+					return err
+				}
+			}
+		}
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; !ok && migration.Version <= version {
+				if err := m.apply(ctx, conn, migration); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// apply is method to run the up statements of migration and record it.
+// MySQL commits each DDL statement on its own, a migration failing midway there has to be fixed by hand.
+func (m *Migrator) apply(ctx context.Context, conn *gorm.DB, migration Migration) error {
+	log := utils.NewLoggerFromContext(ctx, "Migrator", 0).Repository().AddField("version", migration.Version)
+	log.Info("applying %04d_%s", migration.Version, migration.Name)
+
+	return m.transaction(conn, func(tx *gorm.DB) error {
+		if err := execute(tx, migration.Up); err != nil {
+			return fmt.Errorf("apply %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		record := schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+		if err := tx.Create(&record).Error; err != nil {
+			return fmt.Errorf("record %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		return nil
+	})
+}
+
+// revert is method to run the down statements of migration and forget it
+func (m *Migrator) revert(ctx context.Context, conn *gorm.DB, migration Migration) error {
+	log := utils.NewLoggerFromContext(ctx, "Migrator", 0).Repository().AddField("version", migration.Version)
+	log.Info("reverting %04d_%s", migration.Version, migration.Name)
+
+	return m.transaction(conn, func(tx *gorm.DB) error {
+		if err := execute(tx, migration.Down); err != nil {
+			return fmt.Errorf("revert %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if err := tx.Delete(&schemaMigration{}, migration.Version).Error; err != nil {
+			return fmt.Errorf("forget %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		return nil
+	})
+}
+
+// transaction is method to run fn in one transaction on conn where the dialect rolls DDL back, so a migration
+// failing midway leaves no trace, and directly on conn elsewhere
+func (m *Migrator) transaction(conn *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if !m.dialect.TransactionalDDL() {
+		return fn(conn)
+	}
+
+	return conn.Transaction(fn)
+}
+
+// locked is method to run fn on one connection holding the migration lock
+func (m *Migrator) locked(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		// a fresh session per statement, the pinned connection would otherwise carry one statement into the next
+		conn = conn.Session(&gorm.Session{NewDB: true})
+		acquired, err := m.dialect.AcquireLock(conn, lockName, m.lockTimeout)
+		if err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		if !acquired {
+			return ErrLocked
+		}
+		defer m.dialect.ReleaseLock(conn, lockName)
+
+		// the only place the table is created, reading the status needs no DDL
+		err = conn.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (" +
+			"version BIGINT NOT NULL PRIMARY KEY, " +
+			"name VARCHAR(255) NOT NULL, " +
+			"applied_at TIMESTAMP NOT NULL)").Error
+		if err != nil {
+			return fmt.Errorf("create schema_migrations: %w", err)
+		}
+
+		return fn(conn)
+	})
+}
+
+// applied is method to read the applied versions and when they were applied, none while schema_migrations
+// does not exist
+func (m *Migrator) applied(db *gorm.DB) (map[int64]time.Time, error) {
+	var rows []schemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		// checked only after the read failed, so the common case is one query
+		if !db.Migrator().HasTable(&schemaMigration{}) {
+			return map[int64]time.Time{}, nil
+		}
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+
+	applied := make(map[int64]time.Time, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row.AppliedAt
+	}
+
+	return applied, nil
+}
+
+// find index of version in m.migrations, -1 when unknown
+func (m *Migrator) find(version int64) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// load migrations of dir in fsys ordered by version, every version needs an up and a down file
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %q and %q", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if version := migration.Version; version <= 0 || migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d needs a positive version, an up and a down file", version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// execute run every statement of script in order
+func execute(db *gorm.DB, script string) error {
+	for _, statement := range statements(script) {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// statements of script, split on ";" ending a line, "--" comment lines dropped
+func statements(script string) []string {
+	var result []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			result = append(result, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		result = append(result, rest)
+	}
+
+	return result
+}
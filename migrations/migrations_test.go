@@ -0,0 +1,306 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"testing"
+	"testing/fstest"
+	"time"
+	"wyvern-api/dialects"
+	"wyvern-api/models"
+)
+
+const (
+	getLockSQL           = "SELECT GET_LOCK\\(\\?, \\?\\)"
+	releaseLockSQL       = "SELECT RELEASE_LOCK\\(\\?\\)"
+	createTableSQL       = "CREATE TABLE IF NOT EXISTS schema_migrations"
+	selectMigrationsSQL  = "SELECT \\* FROM `schema_migrations` ORDER BY version"
+	insertMigrationSQL   = "INSERT INTO `schema_migrations`"
+	deleteMigrationSQL   = "DELETE FROM `schema_migrations` WHERE `schema_migrations`.`version` = \\?"
+	testMigrationTimeout = time.Second
+)
+
+// newSQLMock Migrator on sqlmock with migrations instead of the embedded ones
+func newSQLMock(t *testing.T, migrations ...Migration) (*Migrator, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Migrator{db: db, dialect: dialects.For(db), migrations: migrations, lockTimeout: testMigrationTimeout}, mock
+}
+
+func appliedRows(versions ...int64) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"version", "name", "applied_at"})
+	for _, version := range versions {
+		rows.AddRow(version, "m", time.Now())
+	}
+
+	return rows
+}
+
+var (
+	first  = Migration{Version: 1, Name: "first", Up: "CREATE TABLE a (id INT);", Down: "DROP TABLE a;"}
+	second = Migration{Version: 2, Name: "second", Up: "CREATE TABLE b (id INT);\nCREATE TABLE c (id INT);", Down: "DROP TABLE c;\nDROP TABLE b;"}
+)
+
+func TestEmbedded(t *testing.T) {
+	reference, err := load(files, "sql/"+dialects.DriverMySQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reference) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+
+	for _, driver := range []string{dialects.DriverMySQL, dialects.DriverPostgres, dialects.DriverSQLite} {
+		migrations, err := load(files, "sql/"+driver)
+		if err != nil {
+			t.Fatalf("%s: %v", driver, err)
+		}
+		if len(migrations) != len(reference) {
+			t.Fatalf("%s: expected %d migrations, got %d", driver, len(reference), len(migrations))
+		}
+
+		for i, migration := range migrations {
+			if migration.Version != int64(i+1) || migration.Name != reference[i].Name {
+				t.Errorf("%s: expected %d_%s, got %d_%s", driver, i+1, reference[i].Name, migration.Version, migration.Name)
+			}
+			if len(statements(migration.Up)) == 0 || len(statements(migration.Down)) == 0 {
+				t.Errorf("%s: expected statements in %d_%s", driver, migration.Version, migration.Name)
+			}
+		}
+	}
+}
+
+// TestSQLite run every migration up, down and up again on an in-memory database
+func TestSQLite(t *testing.T) {
+	m, err := New(OpenTestDB(t), testMigrationTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []func(context.Context) error{m.Up, m.Down, func(ctx context.Context) error { return m.To(ctx, 0) }, m.Up} {
+		if err := step(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Check(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestSQLite_Pending every migration is pending on an empty database, reading that creates nothing
+func TestSQLite_Pending(t *testing.T) {
+	db := OpenTestDB(t)
+	m, err := New(db, testMigrationTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			t.Errorf("expected %04d_%s pending", status.Version, status.Name)
+		}
+	}
+	if err := m.Check(context.Background()); err == nil {
+		t.Error("expected pending migrations")
+	}
+	if db.Migrator().HasTable(&schemaMigration{}) {
+		t.Error("expected no schema_migrations created by Status or Check")
+	}
+}
+
+// TestSQLite_Rollback a migration failing midway leaves nothing behind where DDL is transactional
+func TestSQLite_Rollback(t *testing.T) {
+	m, err := New(OpenTestDB(t), testMigrationTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.migrations = []Migration{{Version: 1, Name: "broken", Up: "CREATE TABLE a (id INT);\nCREATE TABLE a (id INT);", Down: "DROP TABLE a;"}}
+
+	if err := m.Up(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+	if m.db.Migrator().HasTable("a") {
+		t.Error("expected table of the failed migration rolled back")
+	}
+	if statuses, _ := m.Status(context.Background()); statuses[0].AppliedAt != nil {
+		t.Error("expected failed migration not recorded")
+	}
+}
+
+// TestSQLite_HandBuilt apply every migration to the tables created by hand before migrations, with their rows
+func TestSQLite_HandBuilt(t *testing.T) {
+	db := OpenTestDB(t)
+	for _, statement := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username VARCHAR(64) NOT NULL, balance REAL NOT NULL DEFAULT 0, created_at DATETIME NULL)",
+		"CREATE TABLE transactions (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id BIGINT NOT NULL, amount REAL NOT NULL, type VARCHAR(16) NOT NULL, created_at DATETIME NULL)",
+		"INSERT INTO users (username, balance) VALUES ('Fulan', 500)",
+		"INSERT INTO transactions (user_id, amount, type) VALUES (1, 500, 'CREDIT')",
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := New(db, testMigrationTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// every column of the models is there, the rows kept
+	var user models.User
+	if err := db.First(&user, 1).Error; err != nil || user.Balance != 500 || user.Status != models.UserStatusActive {
+		t.Errorf("expected active user with balance 500, got %+v, %v", user, err)
+	}
+	var transaction models.Transaction
+	if err := db.First(&transaction, 1).Error; err != nil || transaction.Amount != 500 {
+		t.Errorf("expected transaction of 500, got %+v, %v", transaction, err)
+	}
+	record := models.Transaction{UserID: 1, Amount: 1, Type: "DEBIT", Reference: "ref", Metadata: models.Metadata{"order": "7"}}
+	if err := db.Create(&record).Error; err != nil {
+		t.Error(err)
+	}
+	if err := db.Create(&models.TransactionMetadata{TransactionID: record.ID, MetaKey: "order", MetaValue: "7"}).Error; err != nil {
+		t.Error(err)
+	}
+	if err := db.Create(&models.Adjustment{UserID: 1, Type: "CREDIT", Amount: 1, Reason: "r", Status: "PENDING", ProposedBy: "a", ExpiresAt: time.Now()}).Error; err != nil {
+		t.Error(err)
+	}
+
+	// reverting everything keeps the tables that were there before the migrations, and their rows
+	if err := m.To(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	var balance float64
+	if err := db.Raw("SELECT balance FROM users WHERE id = 1").Scan(&balance).Error; err != nil || balance != 500 {
+		t.Errorf("expected user kept with balance 500, got %v, %v", balance, err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("orders by version", func(t *testing.T) {
+		migrations, err := load(fstest.MapFS{
+			"sql/0010_b.up.sql":   {Data: []byte("B")},
+			"sql/0010_b.down.sql": {Data: []byte("-B")},
+			"sql/0002_a.up.sql":   {Data: []byte("A")},
+			"sql/0002_a.down.sql": {Data: []byte("-A")},
+		}, "sql")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) != 2 || migrations[0].Name != "a" || migrations[1].Version != 10 || migrations[1].Down != "-B" {
+			t.Errorf("expected a then b, got %+v", migrations)
+		}
+	})
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"missing down": {"sql/0001_a.up.sql": {Data: []byte("A")}},
+		"bad name":     {"sql/a.up.sql": {Data: []byte("A")}},
+		"two names":    {"sql/0001_a.up.sql": {Data: []byte("A")}, "sql/0001_b.down.sql": {Data: []byte("-B")}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := load(fsys, "sql"); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestStatements(t *testing.T) {
+	got := statements("-- comment\nCREATE TABLE a (\n  id INT\n);\n\nDROP TABLE b;\nSELECT 1")
+	expected := []string{"CREATE TABLE a (\n  id INT\n)", "DROP TABLE b", "SELECT 1"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], got[i])
+		}
+	}
+}
+
+func TestMigrator_Up(t *testing.T) {
+	m, mock := newSQLMock(t, first, second)
+	mock.ExpectQuery(getLockSQL).WithArgs(lockName, 1).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectExec(createTableSQL).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(selectMigrationsSQL).WillReturnRows(appliedRows(1))
+	mock.ExpectExec("CREATE TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE c").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insertMigrationSQL).WithArgs("second", sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(releaseLockSQL).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrator_To(t *testing.T) {
+	m, mock := newSQLMock(t, first, second)
+	mock.ExpectQuery(getLockSQL).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectExec(createTableSQL).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(selectMigrationsSQL).WillReturnRows(appliedRows(1, 2))
+	mock.ExpectExec("DROP TABLE c").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DROP TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(deleteMigrationSQL).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(releaseLockSQL).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := m.To(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.To(context.Background(), 3); err == nil {
+		t.Error("expected error for unknown version")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrator_Locked(t *testing.T) {
+	m, mock := newSQLMock(t, first)
+	mock.ExpectQuery(getLockSQL).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+
+	if err := m.Up(context.Background()); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected %v, got %v", ErrLocked, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrator_Check(t *testing.T) {
+	// no DDL, every statement must be expected
+	m, mock := newSQLMock(t, first, second)
+	mock.ExpectQuery(selectMigrationsSQL).WillReturnRows(appliedRows(1))
+	mock.ExpectQuery(selectMigrationsSQL).WillReturnRows(appliedRows(1, 2, 3))
+
+	if err := m.Check(context.Background()); err == nil {
+		t.Error("expected error while 0002_second is pending")
+	}
+	if err := m.Check(context.Background()); err != nil {
+		t.Errorf("expected versions of a newer build accepted, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
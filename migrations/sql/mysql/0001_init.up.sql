@@ -0,0 +1,17 @@
+-- schema before versioned migrations, as created by hand, tables that exist already are kept
+CREATE TABLE IF NOT EXISTS users (
+    id         BIGINT       NOT NULL AUTO_INCREMENT,
+    username   VARCHAR(64)  NOT NULL,
+    balance    DOUBLE       NOT NULL DEFAULT 0,
+    created_at DATETIME(3)  NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id         BIGINT       NOT NULL AUTO_INCREMENT,
+    user_id    BIGINT       NOT NULL,
+    amount     DOUBLE       NOT NULL,
+    type       VARCHAR(16)  NOT NULL,
+    created_at DATETIME(3)  NULL,
+    PRIMARY KEY (id)
+);
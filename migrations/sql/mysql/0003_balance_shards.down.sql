@@ -0,0 +1,3 @@
+DROP TABLE balance_shards;
+
+ALTER TABLE users DROP COLUMN shard_count;
@@ -0,0 +1,6 @@
+CREATE TABLE runtime_settings (
+    name       VARCHAR(100) NOT NULL,
+    value      VARCHAR(255) NOT NULL,
+    updated_at DATETIME(3)  NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (name)
+);
@@ -0,0 +1,41 @@
+-- what the hand-built schema of 0001 lacks: user status, transaction details and metadata, and adjustments
+ALTER TABLE users ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'ACTIVE';
+
+ALTER TABLE transactions
+    ADD COLUMN description VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN reference   VARCHAR(64)  NOT NULL DEFAULT '',
+    ADD COLUMN category    VARCHAR(32)  NOT NULL DEFAULT '',
+    ADD COLUMN metadata    JSON         NULL;
+CREATE INDEX idx_transactions_user_id ON transactions (user_id, id);
+CREATE INDEX idx_transactions_reference ON transactions (reference);
+CREATE INDEX idx_transactions_category ON transactions (category);
+
+CREATE TABLE transaction_metadata (
+    id             BIGINT       NOT NULL AUTO_INCREMENT,
+    transaction_id BIGINT       NOT NULL,
+    meta_key       VARCHAR(40)  NOT NULL,
+    meta_value     VARCHAR(255) NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_transaction_metadata_key_value (meta_key, meta_value),
+    KEY idx_transaction_metadata_transaction_id (transaction_id)
+);
+
+CREATE TABLE adjustments (
+    id             BIGINT       NOT NULL AUTO_INCREMENT,
+    user_id        BIGINT       NOT NULL,
+    type           VARCHAR(16)  NOT NULL,
+    amount         DOUBLE       NOT NULL,
+    reason         VARCHAR(255) NOT NULL,
+    status         VARCHAR(16)  NOT NULL,
+    proposed_by    VARCHAR(64)  NOT NULL,
+    reviewed_by    VARCHAR(64)  NOT NULL DEFAULT '',
+    review_note    VARCHAR(255) NOT NULL DEFAULT '',
+    failure_reason VARCHAR(255) NOT NULL DEFAULT '',
+    transaction_id BIGINT       NULL,
+    expires_at     DATETIME(3)  NOT NULL,
+    reviewed_at    DATETIME(3)  NULL,
+    created_at     DATETIME(3)  NULL,
+    PRIMARY KEY (id),
+    KEY idx_adjustments_status_expires_at (status, expires_at),
+    KEY idx_adjustments_user_id (user_id)
+);
@@ -0,0 +1,15 @@
+-- schema before versioned migrations, as created by hand, tables that exist already are kept
+CREATE TABLE IF NOT EXISTS users (
+    id         BIGSERIAL        PRIMARY KEY,
+    username   VARCHAR(64)      NOT NULL,
+    balance    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ(3)   NULL
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id         BIGSERIAL        PRIMARY KEY,
+    user_id    BIGINT           NOT NULL,
+    amount     DOUBLE PRECISION NOT NULL,
+    type       VARCHAR(16)      NOT NULL,
+    created_at TIMESTAMPTZ(3)   NULL
+);
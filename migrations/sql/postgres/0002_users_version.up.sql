@@ -0,0 +1,2 @@
+-- version checked by the optimistic balance strategy
+ALTER TABLE users ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN shard_count INT NOT NULL DEFAULT 0;
+
+CREATE TABLE balance_shards (
+    user_id  BIGINT           NOT NULL,
+    shard_no INT              NOT NULL,
+    balance  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, shard_no)
+);
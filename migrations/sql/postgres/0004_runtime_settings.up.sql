@@ -0,0 +1,6 @@
+CREATE TABLE runtime_settings (
+    name       VARCHAR(100)   NOT NULL,
+    value      VARCHAR(255)   NOT NULL,
+    updated_at TIMESTAMPTZ(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (name)
+);
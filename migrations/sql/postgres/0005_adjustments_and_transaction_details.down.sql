@@ -0,0 +1,13 @@
+DROP TABLE adjustments;
+DROP TABLE transaction_metadata;
+
+DROP INDEX idx_transactions_category;
+DROP INDEX idx_transactions_reference;
+DROP INDEX idx_transactions_user_id;
+ALTER TABLE transactions
+    DROP COLUMN metadata,
+    DROP COLUMN category,
+    DROP COLUMN reference,
+    DROP COLUMN description;
+
+ALTER TABLE users DROP COLUMN status;
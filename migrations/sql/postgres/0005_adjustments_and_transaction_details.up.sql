@@ -0,0 +1,39 @@
+-- what the hand-built schema of 0001 lacks: user status, transaction details and metadata, and adjustments
+ALTER TABLE users ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'ACTIVE';
+
+ALTER TABLE transactions
+    ADD COLUMN description VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN reference   VARCHAR(64)  NOT NULL DEFAULT '',
+    ADD COLUMN category    VARCHAR(32)  NOT NULL DEFAULT '',
+    ADD COLUMN metadata    JSON         NULL;
+CREATE INDEX idx_transactions_user_id ON transactions (user_id, id);
+CREATE INDEX idx_transactions_reference ON transactions (reference);
+CREATE INDEX idx_transactions_category ON transactions (category);
+
+CREATE TABLE transaction_metadata (
+    id             BIGSERIAL    PRIMARY KEY,
+    transaction_id BIGINT       NOT NULL,
+    meta_key       VARCHAR(40)  NOT NULL,
+    meta_value     VARCHAR(255) NOT NULL
+);
+CREATE INDEX idx_transaction_metadata_key_value ON transaction_metadata (meta_key, meta_value);
+CREATE INDEX idx_transaction_metadata_transaction_id ON transaction_metadata (transaction_id);
+
+CREATE TABLE adjustments (
+    id             BIGSERIAL        PRIMARY KEY,
+    user_id        BIGINT           NOT NULL,
+    type           VARCHAR(16)      NOT NULL,
+    amount         DOUBLE PRECISION NOT NULL,
+    reason         VARCHAR(255)     NOT NULL,
+    status         VARCHAR(16)      NOT NULL,
+    proposed_by    VARCHAR(64)      NOT NULL,
+    reviewed_by    VARCHAR(64)      NOT NULL DEFAULT '',
+    review_note    VARCHAR(255)     NOT NULL DEFAULT '',
+    failure_reason VARCHAR(255)     NOT NULL DEFAULT '',
+    transaction_id BIGINT           NULL,
+    expires_at     TIMESTAMPTZ(3)   NOT NULL,
+    reviewed_at    TIMESTAMPTZ(3)   NULL,
+    created_at     TIMESTAMPTZ(3)   NULL
+);
+CREATE INDEX idx_adjustments_status_expires_at ON adjustments (status, expires_at);
+CREATE INDEX idx_adjustments_user_id ON adjustments (user_id);
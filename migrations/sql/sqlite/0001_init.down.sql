@@ -0,0 +1,3 @@
+-- users and transactions may predate the migrations and hold the production data, reverting the baseline keeps them.
+-- Drop them by hand to really start over
+SELECT 1;
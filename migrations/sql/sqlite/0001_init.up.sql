@@ -0,0 +1,15 @@
+-- schema before versioned migrations, as created by hand, tables that exist already are kept
+CREATE TABLE IF NOT EXISTS users (
+    id         INTEGER     PRIMARY KEY AUTOINCREMENT,
+    username   VARCHAR(64) NOT NULL,
+    balance    REAL        NOT NULL DEFAULT 0,
+    created_at DATETIME    NULL
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id         INTEGER     PRIMARY KEY AUTOINCREMENT,
+    user_id    BIGINT      NOT NULL,
+    amount     REAL        NOT NULL,
+    type       VARCHAR(16) NOT NULL,
+    created_at DATETIME    NULL
+);
@@ -0,0 +1,6 @@
+CREATE TABLE runtime_settings (
+    name       VARCHAR(100) NOT NULL,
+    value      VARCHAR(255) NOT NULL,
+    updated_at DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (name)
+);
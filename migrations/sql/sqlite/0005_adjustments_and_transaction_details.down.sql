@@ -0,0 +1,12 @@
+DROP TABLE adjustments;
+DROP TABLE transaction_metadata;
+
+DROP INDEX idx_transactions_category;
+DROP INDEX idx_transactions_reference;
+DROP INDEX idx_transactions_user_id;
+ALTER TABLE transactions DROP COLUMN metadata;
+ALTER TABLE transactions DROP COLUMN category;
+ALTER TABLE transactions DROP COLUMN reference;
+ALTER TABLE transactions DROP COLUMN description;
+
+ALTER TABLE users DROP COLUMN status;
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"testing"
+	"time"
+	"wyvern-api/dialects"
+)
+
+// OpenTestDB empty in-memory SQLite database of its own for tests, closed when t ends
+func OpenTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	dialect, _ := dialects.Get(dialects.DriverSQLite)
+	db, err := gorm.Open(dialect.Dialector(dialects.Connection{Database: ":memory:"}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialect.Configure(sqlDB)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	return db
+}
+
+// NewTestDB OpenTestDB with every embedded migration applied
+func NewTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db := OpenTestDB(t)
+	migrator, err := New(db, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Adjustment status
+const (
+	AdjustmentStatusPending  = "PENDING"
+	AdjustmentStatusApproved = "APPROVED"
+	AdjustmentStatusRejected = "REJECTED"
+	AdjustmentStatusExpired  = "EXPIRED"
+	AdjustmentStatusFailed   = "FAILED"
+)
+
+// Adjustment struct adjustments table, a manual credit/debit waiting for a second operator
+type Adjustment struct {
+	ID            int64      `gorm:"column:id" json:"id"`
+	UserID        int64      `gorm:"column:user_id" json:"user_id"`
+	Type          string     `gorm:"column:type" json:"type"`
+	Amount        float64    `gorm:"column:amount" json:"amount"`
+	Reason        string     `gorm:"column:reason" json:"reason"`
+	Status        string     `gorm:"column:status" json:"status"`
+	ProposedBy    string     `gorm:"column:proposed_by" json:"proposed_by"`
+	ReviewedBy    string     `gorm:"column:reviewed_by" json:"reviewed_by"`
+	ReviewNote    string     `gorm:"column:review_note" json:"review_note"`
+	FailureReason string     `gorm:"column:failure_reason" json:"failure_reason"`
+	TransactionID *int64     `gorm:"column:transaction_id" json:"transaction_id"`
+	ExpiresAt     time.Time  `gorm:"column:expires_at" json:"expires_at"`
+	ReviewedAt    *time.Time `gorm:"column:reviewed_at" json:"reviewed_at"`
+	CreatedAt     time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+// StatusAt status of adjustment at now, a pending adjustment past its deadline is EXPIRED.
+// Expiry is never written, the stored status stays PENDING and reads derive EXPIRED from expires_at.
+func (adjustment Adjustment) StatusAt(now time.Time) string {
+	if adjustment.Status == AdjustmentStatusPending && !adjustment.ExpiresAt.After(now) {
+		return AdjustmentStatusExpired
+	}
+
+	return adjustment.Status
+}
+
+// ProposeAdjustmentRequest struct for propose adjustment request
+type ProposeAdjustmentRequest struct {
+	UserID int64   `json:"user_id" binding:"required,gt=0"`
+	Type   string  `json:"type" binding:"required,oneof=CREDIT DEBIT"`
+	Amount float64 `json:"amount" binding:"required,gt=0,max_amount,amount_precision"`
+	Reason string  `json:"reason" binding:"required,max=255"`
+}
+
+// ReviewAdjustmentRequest struct for approve/reject adjustment request
+type ReviewAdjustmentRequest struct {
+	Note string `json:"note" binding:"omitempty,max=255"`
+}
+
+// AdjustmentFilter struct for adjustment history query
+type AdjustmentFilter struct {
+	UserID     int64  `form:"user_id" binding:"omitempty,gt=0"`
+	Status     string `form:"status" binding:"omitempty,oneof=PENDING APPROVED REJECTED EXPIRED FAILED"`
+	ProposedBy string `form:"proposed_by"`
+	ReviewedBy string `form:"reviewed_by"`
+	Limit      int    `form:"limit" binding:"omitempty,gte=0,lte=100"`
+	Offset     int    `form:"offset" binding:"omitempty,gte=0"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// BalanceShard struct balance_shards table, one slice of the balance of a sharded user
+type BalanceShard struct {
+	UserID  int64   `gorm:"column:user_id;primaryKey" json:"user_id"`
+	ShardNo int     `gorm:"column:shard_no;primaryKey" json:"shard_no"`
+	Balance float64 `gorm:"column:balance" json:"balance"`
+}
+
+// TableName table of BalanceShard
+func (BalanceShard) TableName() string {
+	return "balance_shards"
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+)
+
+// AppError struct domain error with a stable code, Status is the http status written for it
+type AppError struct {
+	Code    string
+	Status  int
+	Title   string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+// FieldError struct detail of one invalid request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error codes and their http status, keep the code stable because clients match on it
+var (
+	ErrInvalidRequest        = NewAppError("INVALID_REQUEST", http.StatusBadRequest, "Invalid request")
+	ErrInvalidAmount         = NewAppError("INVALID_AMOUNT", http.StatusBadRequest, "Invalid amount")
+	ErrValidation            = NewAppError("VALIDATION_FAILED", http.StatusBadRequest, "Request validation failed")
+	ErrOperatorRequired      = NewAppError("OPERATOR_REQUIRED", http.StatusBadRequest, "Operator is required")
+	ErrOperatorUnauthorized  = NewAppError("OPERATOR_UNAUTHORIZED", http.StatusUnauthorized, "Operator key is missing or unknown")
+	ErrUserNotFound          = NewAppError("USER_NOT_FOUND", http.StatusNotFound, "User not found")
+	ErrAdjustmentNotFound    = NewAppError("ADJUSTMENT_NOT_FOUND", http.StatusNotFound, "Adjustment not found")
+	ErrAccountFrozen         = NewAppError("ACCOUNT_FROZEN", http.StatusForbidden, "Account is frozen")
+	ErrSelfApproval          = NewAppError("SELF_APPROVAL_NOT_ALLOWED", http.StatusForbidden, "Approver must be different from proposer")
+	ErrLockConflict          = NewAppError("LOCK_CONFLICT", http.StatusConflict, "Account is being updated concurrently, please retry")
+	ErrVersionConflict       = NewAppError("VERSION_CONFLICT", http.StatusConflict, "Account was updated concurrently, please retry")
+	ErrAdjustmentNotPending  = NewAppError("ADJUSTMENT_NOT_PENDING", http.StatusConflict, "Adjustment is no longer pending")
+	ErrInsufficientFunds     = NewAppError("INSUFFICIENT_FUNDS", http.StatusUnprocessableEntity, "Insufficient funds")
+	ErrApprovalRequired      = NewAppError("APPROVAL_REQUIRED", http.StatusUnprocessableEntity, "Amount is above the approval threshold, propose an adjustment")
+	ErrPayloadTooLarge       = NewAppError("PAYLOAD_TOO_LARGE", http.StatusRequestEntityTooLarge, "Request body is too large")
+	ErrRateLimited           = NewAppError("RATE_LIMITED", http.StatusTooManyRequests, "Too many requests")
+	ErrDatabase              = NewAppError("DATABASE_ERROR", http.StatusInternalServerError, "Database error")
+	ErrTimeout               = NewAppError("TIMEOUT", http.StatusGatewayTimeout, "Request timed out")
+	ErrRequestCanceled       = NewAppError("REQUEST_CANCELED", StatusClientClosedRequest, "Request canceled by client")
+	ErrCommitFailed          = NewAppError("COMMIT_FAILED", http.StatusInternalServerError, "Failed to commit transaction")
+	ErrTransactionNotCreated = NewAppError("TRANSACTION_NOT_CREATED", http.StatusInternalServerError, "Failed to create transaction")
+	ErrInternal              = NewAppError("INTERNAL_ERROR", http.StatusInternalServerError, "Internal server error")
+	ErrNotReady              = NewAppError("SERVICE_NOT_READY", http.StatusServiceUnavailable, "Service not ready")
+)
+
+// StatusClientClosedRequest non standard status for a request the client gave up on, nobody reads the response
+const StatusClientClosedRequest = 499
+
+// NewAppError initiate AppError
+func NewAppError(code string, status int, title string) *AppError {
+	return &AppError{
+		Code:    code,
+		Status:  status,
+		Title:   title,
+		Message: title,
+	}
+}
+
+// Error implement error
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Message + ": " + e.Err.Error()
+	}
+
+	return e.Code + ": " + e.Message
+}
+
+// Unwrap return the cause
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// Is match AppError by code, so errors.Is(err, ErrUserNotFound) works on copies
+func (e *AppError) Is(target error) bool {
+	var t *AppError
+	if !errors.As(target, &t) {
+		return false
+	}
+
+	return e.Code == t.Code
+}
+
+// Wrap return copy of error with the cause, the cause is logged but never sent to client
+func (e *AppError) Wrap(err error) *AppError {
+	clone := *e
+	clone.Err = err
+	return &clone
+}
+
+// WithMessage return copy of error with a more specific message
+func (e *AppError) WithMessage(msg string) *AppError {
+	clone := *e
+	clone.Message = msg
+	return &clone
+}
+
+// WithFields return copy of error with field level details
+func (e *AppError) WithFields(fields []FieldError) *AppError {
+	clone := *e
+	clone.Fields = fields
+	return &clone
+}
+
+// AsAppError convert any error to AppError, unknown errors become ErrInternal
+func AsAppError(err error) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	return ErrInternal.Wrap(err)
+}
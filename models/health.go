@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Health status
+const (
+	HealthStatusOK       = "ok"
+	HealthStatusFailing  = "failing"
+	HealthStatusDraining = "draining"
+)
+
+// HealthCheckResult struct result of one dependency check
+type HealthCheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// HealthReport struct readiness report
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks"`
+}
+
+// DBPoolStats struct sql.DB pool stats
+type DBPoolStats struct {
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`
+	WaitDuration       string `json:"wait_duration"`
+	MaxIdleClosed      int64  `json:"max_idle_closed"`
+	MaxLifetimeClosed  int64  `json:"max_lifetime_closed"`
+}
+
+// StatusReport struct detailed status for operators
+type StatusReport struct {
+	Version           string       `json:"version"`
+	GoVersion         string       `json:"go_version"`
+	StartedAt         time.Time    `json:"started_at"`
+	Uptime            string       `json:"uptime"`
+	Draining          bool         `json:"draining"`
+	ConfigFingerprint string       `json:"config_fingerprint"`
+	DBPool            DBPoolStats  `json:"db_pool"`
+	Readiness         HealthReport `json:"readiness"`
+}
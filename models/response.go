@@ -22,10 +22,25 @@ type Response struct {
 
 // ResponseV2 struct for response
 type ResponseV2 struct {
-	Code    int    `json:"code"`
-	Status  string `json:"status"`
-	Message string `json:"message"`
-	Data    any    `json:"data"`
+	Code      int          `json:"code"`
+	Status    string       `json:"status"`
+	Message   string       `json:"message"`
+	ErrorCode string       `json:"error_code,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Data      any          `json:"data"`
+}
+
+// Problem struct for RFC 7807 application/problem+json response
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
 }
 
 // ResponseWithoutData struct
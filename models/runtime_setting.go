@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// RuntimeSetting struct runtime_settings table, a config value changed at runtime, overriding every other layer
+type RuntimeSetting struct {
+	Name      string    `gorm:"column:name;primaryKey" json:"name"`
+	Value     string    `gorm:"column:value" json:"value"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName table of RuntimeSetting
+func (RuntimeSetting) TableName() string {
+	return "runtime_settings"
+}
@@ -1,20 +1,91 @@
 package models
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 // Transaction struct transaction table
 type Transaction struct {
-	ID        int64     `gorm:"column:id" json:"id"`
-	UserID    int64     `gorm:"column:user_id" json:"user_id"`
-	Amount    float64   `gorm:"column:amount" json:"amount"`
-	Type      string    `gorm:"column:type" json:"type"`
-	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	ID          int64     `gorm:"column:id" json:"id"`
+	UserID      int64     `gorm:"column:user_id" json:"user_id"`
+	Amount      float64   `gorm:"column:amount" json:"amount"`
+	Type        string    `gorm:"column:type" json:"type"`
+	Description string    `gorm:"column:description" json:"description"`
+	Reference   string    `gorm:"column:reference" json:"reference"`
+	Category    string    `gorm:"column:category" json:"category"`
+	Metadata    Metadata  `gorm:"column:metadata" json:"metadata"`
+	CreatedAt   time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+// TransactionMetadata struct transaction_metadata table, one row per metadata key for lookup by key and value
+type TransactionMetadata struct {
+	ID            int64  `gorm:"column:id" json:"id"`
+	TransactionID int64  `gorm:"column:transaction_id" json:"transaction_id"`
+	MetaKey       string `gorm:"column:meta_key" json:"meta_key"`
+	MetaValue     string `gorm:"column:meta_value" json:"meta_value"`
+}
+
+// TableName table of TransactionMetadata
+func (TransactionMetadata) TableName() string {
+	return "transaction_metadata"
+}
+
+// Metadata free-form key value of a transaction, stored as json
+type Metadata map[string]string
+
+// GormDataType implement schema.GormDataTypeInterface, gorm can not infer the column type from a nil Value
+func (Metadata) GormDataType() string {
+	return "json"
+}
+
+// Value implement driver.Valuer
+func (m Metadata) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(m)
+	return string(b), err
+}
+
+// Scan implement sql.Scanner
+func (m *Metadata) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	}
+
+	return fmt.Errorf("unsupported metadata type %T", value)
+}
+
+// TransactionFilter struct for transaction history query
+type TransactionFilter struct {
+	UserID    int64  `form:"user_id" binding:"omitempty,gt=0"`
+	Type      string `form:"type" binding:"omitempty,oneof=CREDIT DEBIT"`
+	Reference string `form:"reference" binding:"omitempty,max=64"`
+	Category  string `form:"category" binding:"omitempty,max=32"`
+	MetaKey   string `form:"meta_key" binding:"required_with=MetaValue,max=40"`
+	MetaValue string `form:"meta_value" binding:"omitempty,max=255"`
+	Limit     int    `form:"limit" binding:"omitempty,gte=0,lte=100"`
+	Offset    int    `form:"offset" binding:"omitempty,gte=0"`
 }
 
 // CreditRequest struct for credit request
 type CreditRequest struct {
-	UserID int64   `json:"user_id"`
-	Amount float64 `json:"amount"`
+	UserID      int64    `json:"user_id" binding:"required,gt=0"`
+	Amount      float64  `json:"amount" binding:"required,gt=0,max_amount,amount_precision"`
+	Description string   `json:"description" binding:"omitempty,max=255"`
+	Reference   string   `json:"reference" binding:"omitempty,max=64"`
+	Category    string   `json:"category" binding:"omitempty,max=32"`
+	Metadata    Metadata `json:"metadata" binding:"omitempty,max=20,dive,keys,required,max=40,endkeys,max=255"`
 }
 
 // CreditResponse for credit response
@@ -25,8 +96,12 @@ type CreditResponse struct {
 
 // DebitRequest struct for debit request
 type DebitRequest struct {
-	UserID int64   `json:"user_id"`
-	Amount float64 `json:"amount"`
+	UserID      int64    `json:"user_id" binding:"required,gt=0"`
+	Amount      float64  `json:"amount" binding:"required,gt=0,max_amount,amount_precision"`
+	Description string   `json:"description" binding:"omitempty,max=255"`
+	Reference   string   `json:"reference" binding:"omitempty,max=64"`
+	Category    string   `json:"category" binding:"omitempty,max=32"`
+	Metadata    Metadata `json:"metadata" binding:"omitempty,max=20,dive,keys,required,max=40,endkeys,max=255"`
 }
 
 // DebitResponse for debit response
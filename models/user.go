@@ -2,10 +2,20 @@ package models
 
 import "time"
 
+// User status
+const (
+	UserStatusActive = "ACTIVE"
+	UserStatusFrozen = "FROZEN"
+)
+
 // User struct user
 type User struct {
-	ID        int64     `gorm:"column:id" json:"id"`
-	Username  string    `gorm:"column:username" json:"username"`
-	Balance   float64   `gorm:"column:balance" json:"balance"`
-	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	ID       int64   `gorm:"column:id" json:"id"`
+	Username string  `gorm:"column:username" json:"username"`
+	Balance  float64 `gorm:"column:balance" json:"balance"`
+	Status   string  `gorm:"column:status;default:ACTIVE" json:"status"`
+	Version  int64   `gorm:"column:version;default:0" json:"-"`
+	// ShardCount number of balance_shards rows holding the balance, 0 when Balance holds it
+	ShardCount int       `gorm:"column:shard_count;default:0" json:"-"`
+	CreatedAt  time.Time `gorm:"column:created_at" json:"created_at"`
 }
@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+	"wyvern-api/models"
+)
+
+// AdjustmentRepo struct
+type AdjustmentRepo struct {
+	db *gorm.DB
+}
+
+// NewAdjustmentRepo initiate AdjustmentRepo
+func NewAdjustmentRepo(db *gorm.DB) *AdjustmentRepo {
+	return &AdjustmentRepo{
+		db: db,
+	}
+}
+
+// Insert is method to insert adjustment
+func (repo *AdjustmentRepo) Insert(ctx context.Context, db *gorm.DB, adjustment models.Adjustment) (models.Adjustment, error) {
+	result := db.WithContext(ctx).Create(&adjustment)
+	if result.Error != nil {
+		logError(ctx, "Insert", result.Error)
+		return adjustment, result.Error
+	}
+
+	return adjustment, nil
+}
+
+// FindByID is method to find adjustment by id
+func (repo *AdjustmentRepo) FindByID(ctx context.Context, db *gorm.DB, ID int64) (models.Adjustment, error) {
+	var adjustment models.Adjustment
+	result := db.WithContext(ctx).First(&adjustment, ID)
+	if result.Error != nil {
+		logError(ctx, "FindByID", result.Error)
+		return adjustment, result.Error
+	}
+
+	return adjustment, nil
+}
+
+// Review is method to move a pending, unexpired adjustment to status.
+// It returns false when another operator already reviewed it or it has expired.
+func (repo *AdjustmentRepo) Review(ctx context.Context, db *gorm.DB, ID int64, status string, reviewedBy string, note string, now time.Time) (bool, error) {
+	result := db.WithContext(ctx).Model(&models.Adjustment{}).
+		Where("id = ? AND status = ? AND expires_at > ?", ID, models.AdjustmentStatusPending, now).
+		Updates(map[string]any{
+			"status":      status,
+			"reviewed_by": reviewedBy,
+			"review_note": note,
+			"reviewed_at": now,
+		})
+	if result.Error != nil {
+		logError(ctx, "Review", result.Error)
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// Update is method to update adjustment
+func (repo *AdjustmentRepo) Update(ctx context.Context, db *gorm.DB, adjustment models.Adjustment) (models.Adjustment, error) {
+	result := db.WithContext(ctx).Save(&adjustment)
+	if result.Error != nil {
+		logError(ctx, "Update", result.Error)
+		return adjustment, result.Error
+	}
+
+	return adjustment, nil
+}
+
+// List is method to find adjustments by filter, newest first. The status filter applies to the status at now,
+// a pending adjustment past its deadline is listed as EXPIRED, see models.Adjustment.StatusAt
+func (repo *AdjustmentRepo) List(ctx context.Context, db *gorm.DB, filter models.AdjustmentFilter, now time.Time) ([]models.Adjustment, error) {
+	query := db.WithContext(ctx).Model(&models.Adjustment{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	switch filter.Status {
+	case "":
+	case models.AdjustmentStatusPending:
+		query = query.Where("status = ? AND expires_at > ?", models.AdjustmentStatusPending, now)
+	case models.AdjustmentStatusExpired:
+		query = query.Where("(status = ? OR (status = ? AND expires_at <= ?))", models.AdjustmentStatusExpired, models.AdjustmentStatusPending, now)
+	default:
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.ProposedBy != "" {
+		query = query.Where("proposed_by = ?", filter.ProposedBy)
+	}
+	if filter.ReviewedBy != "" {
+		query = query.Where("reviewed_by = ?", filter.ReviewedBy)
+	}
+
+	var adjustments []models.Adjustment
+	result := query.Order("id DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&adjustments)
+	if result.Error != nil {
+		logError(ctx, "List", result.Error)
+		return adjustments, result.Error
+	}
+
+	return adjustments, nil
+}
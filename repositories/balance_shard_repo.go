@@ -0,0 +1,139 @@
+package repositories
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"wyvern-api/dialects"
+	"wyvern-api/models"
+)
+
+// BalanceShardRepo struct
+type BalanceShardRepo struct {
+	db *gorm.DB
+}
+
+// NewBalanceShardRepo initiate BalanceShardRepo
+func NewBalanceShardRepo(db *gorm.DB) *BalanceShardRepo {
+	return &BalanceShardRepo{
+		db: db,
+	}
+}
+
+// AddBalance is method to add amount to one shard, a negative amount deducts it.
+// It returns false when the shard does not exist.
+func (repo *BalanceShardRepo) AddBalance(ctx context.Context, db *gorm.DB, userID int64, shardNo int, amount float64) (bool, error) {
+	result := db.WithContext(ctx).Model(&models.BalanceShard{}).
+		Where("user_id = ? AND shard_no = ?", userID, shardNo).
+		Update("balance", gorm.Expr("balance + ?", amount))
+	if result.Error != nil {
+		logError(ctx, "AddBalance", result.Error)
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// LockByNo is method to find one shard and lock it until the transaction of db ends
+func (repo *BalanceShardRepo) LockByNo(ctx context.Context, db *gorm.DB, userID int64, shardNo int) (models.BalanceShard, error) {
+	var shard models.BalanceShard
+	result := db.WithContext(ctx).Scopes(dialects.Lock("UPDATE", false)).
+		Where("user_id = ? AND shard_no = ?", userID, shardNo).
+		Take(&shard)
+	if result.Error != nil {
+		logError(ctx, "LockByNo", result.Error)
+		return shard, result.Error
+	}
+
+	return shard, nil
+}
+
+// LockAll is method to find every shard of user ordered by shard_no and lock them until the transaction of db ends
+func (repo *BalanceShardRepo) LockAll(ctx context.Context, db *gorm.DB, userID int64) ([]models.BalanceShard, error) {
+	var shards []models.BalanceShard
+	result := db.WithContext(ctx).Scopes(dialects.Lock("UPDATE", false)).
+		Where("user_id = ?", userID).
+		Order("shard_no").
+		Find(&shards)
+	if result.Error != nil {
+		logError(ctx, "LockAll", result.Error)
+		return shards, result.Error
+	}
+
+	return shards, nil
+}
+
+// LockAvailable is method to find and lock the shards of user that nobody else holds, ordered by shard_no.
+// Shards locked by others are left out instead of waited for.
+func (repo *BalanceShardRepo) LockAvailable(ctx context.Context, db *gorm.DB, userID int64) ([]models.BalanceShard, error) {
+	var shards []models.BalanceShard
+	result := db.WithContext(ctx).Scopes(dialects.Lock("UPDATE", true)).
+		Where("user_id = ?", userID).
+		Order("shard_no").
+		Find(&shards)
+	if result.Error != nil {
+		logError(ctx, "LockAvailable", result.Error)
+		return shards, result.Error
+	}
+
+	return shards, nil
+}
+
+// Sum is method to sum the shards of user
+func (repo *BalanceShardRepo) Sum(ctx context.Context, db *gorm.DB, userID int64) (float64, error) {
+	var sum float64
+	result := db.WithContext(ctx).Model(&models.BalanceShard{}).
+		Select("COALESCE(SUM(balance), 0)").
+		Where("user_id = ?", userID).
+		Scan(&sum)
+	if result.Error != nil {
+		logError(ctx, "Sum", result.Error)
+		return sum, result.Error
+	}
+
+	return sum, nil
+}
+
+// Replace is method to replace every shard of user by shards
+func (repo *BalanceShardRepo) Replace(ctx context.Context, db *gorm.DB, userID int64, shards []models.BalanceShard) error {
+	result := db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.BalanceShard{})
+	if result.Error != nil {
+		logError(ctx, "Replace", result.Error)
+		return result.Error
+	}
+	if len(shards) == 0 {
+		return nil
+	}
+
+	result = db.WithContext(ctx).Create(&shards)
+	if result.Error != nil {
+		logError(ctx, "Replace", result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+// SetBalance is method to overwrite the balance of one shard
+func (repo *BalanceShardRepo) SetBalance(ctx context.Context, db *gorm.DB, userID int64, shardNo int, balance float64) error {
+	result := db.WithContext(ctx).Model(&models.BalanceShard{}).
+		Where("user_id = ? AND shard_no = ?", userID, shardNo).
+		Update("balance", balance)
+	if result.Error != nil {
+		logError(ctx, "SetBalance", result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+// ShardedUserIDs is method to list the users whose balance is sharded
+func (repo *BalanceShardRepo) ShardedUserIDs(ctx context.Context, db *gorm.DB) ([]int64, error) {
+	var IDs []int64
+	result := db.WithContext(ctx).Model(&models.User{}).Where("shard_count > 0").Order("id").Pluck("id", &IDs)
+	if result.Error != nil {
+		logError(ctx, "ShardedUserIDs", result.Error)
+		return IDs, result.Error
+	}
+
+	return IDs, nil
+}
@@ -0,0 +1,357 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"gorm.io/gorm"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+	"wyvern-api/models"
+)
+
+// memoryTxKey gorm setting of the handle passed to MemoryStore.Run, it carries the memoryTx
+const memoryTxKey = "repositories:memory_tx"
+
+// MemoryStore users and transactions held in memory, for tests of the services without a database.
+// Run is a TxRunner: changes of a transaction are seen only by itself until commit and dropped on rollback,
+// and a row written or locked by a transaction stays locked until it ends, like InnoDB with READ COMMITTED.
+// Statements outside Run commit on their own.
+type MemoryStore struct {
+	db *gorm.DB
+
+	mu           sync.Mutex
+	users        map[int64]models.User
+	transactions []models.Transaction
+	rows         map[int64]chan struct{}
+	lastUserID   int64
+	lastTrxID    int64
+}
+
+// memoryTx changes and row locks of one transaction, used by one goroutine at a time like a sql.Tx
+type memoryTx struct {
+	users        map[int64]models.User
+	transactions []models.Transaction
+	locks        map[int64]chan struct{}
+	done         bool
+}
+
+// NewMemoryStore initiate MemoryStore
+func NewMemoryStore() *MemoryStore {
+	// a gorm handle without connection, only to carry the transaction through the *gorm.DB of the processors
+	db, err := gorm.Open(nil, &gorm.Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	return &MemoryStore{
+		db:    db,
+		users: map[int64]models.User{},
+		rows:  map[int64]chan struct{}{},
+	}
+}
+
+// DB handle of MemoryStore for the services, statements on it run outside a transaction
+func (s *MemoryStore) DB() *gorm.DB {
+	return s.db
+}
+
+// AddUser is method to insert user as committed, an ID is assigned when it has none
+func (s *MemoryStore) AddUser(user models.User) models.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user.ID == 0 {
+		user.ID = s.lastUserID + 1
+	}
+	s.lastUserID = max(s.lastUserID, user.ID)
+	if user.Status == "" {
+		user.Status = models.UserStatusActive
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	s.users[user.ID] = user
+
+	return user
+}
+
+// Run begin a transaction and pass it to fn. The transaction is committed only when fn returns nil, it is rolled
+// back when fn returns an error or panics, or when ctx ended before commit. It is never retried.
+func (s *MemoryStore) Run(ctx context.Context, fn func(tx *gorm.DB) error) (err error) {
+	t := &memoryTx{users: map[int64]models.User{}, locks: map[int64]chan struct{}{}}
+	committed := false
+	defer func() {
+		if !committed {
+			s.end(t, false)
+		}
+	}()
+
+	if err := fn(s.db.WithContext(ctx).Set(memoryTxKey, t)); err != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		return models.ErrCommitFailed.Wrap(sql.ErrTxDone)
+	}
+	s.end(t, true)
+	committed = true
+
+	return nil
+}
+
+// statement run fn in the transaction of db, or in a transaction of its own committed right after
+func (s *MemoryStore) statement(ctx context.Context, db *gorm.DB, fn func(t *memoryTx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if t := memoryTxOf(db); t != nil {
+		if t.done {
+			return sql.ErrTxDone
+		}
+		return fn(t)
+	}
+
+	t := &memoryTx{users: map[int64]models.User{}, locks: map[int64]chan struct{}{}}
+	err := fn(t)
+	s.end(t, err == nil)
+
+	return err
+}
+
+// lock is method to lock the row of user ID for t, waiting for the transaction holding it until ctx ends
+func (s *MemoryStore) lock(ctx context.Context, t *memoryTx, ID int64) error {
+	if _, ok := t.locks[ID]; ok {
+		return nil
+	}
+
+	s.mu.Lock()
+	row, ok := s.rows[ID]
+	if !ok {
+		row = make(chan struct{}, 1)
+		s.rows[ID] = row
+	}
+	s.mu.Unlock()
+
+	select {
+	case row <- struct{}{}:
+		t.locks[ID] = row
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// user is method to read user ID as t sees it, its own change or the last committed one
+func (s *MemoryStore) user(t *memoryTx, ID int64) (models.User, error) {
+	if user, ok := t.users[ID]; ok {
+		return user, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[ID]
+	if !ok {
+		return models.User{}, gorm.ErrRecordNotFound
+	}
+
+	return user, nil
+}
+
+// end is method to commit or roll back t and release its row locks
+func (s *MemoryStore) end(t *memoryTx, commit bool) {
+	if t.done {
+		return
+	}
+	t.done = true
+
+	if commit {
+		s.mu.Lock()
+		maps.Copy(s.users, t.users)
+		s.transactions = append(s.transactions, t.transactions...)
+		s.mu.Unlock()
+	}
+
+	for _, row := range t.locks {
+		<-row
+	}
+}
+
+// memoryTxOf transaction carried by db, nil outside MemoryStore.Run
+func memoryTxOf(db *gorm.DB) *memoryTx {
+	if db == nil {
+		return nil
+	}
+
+	value, _ := db.Get(memoryTxKey)
+	t, _ := value.(*memoryTx)
+	return t
+}
+
+// MemoryUserRepo services.UserProcessor on MemoryStore
+type MemoryUserRepo struct {
+	store *MemoryStore
+}
+
+// NewMemoryUserRepo initiate MemoryUserRepo
+func NewMemoryUserRepo(store *MemoryStore) *MemoryUserRepo {
+	return &MemoryUserRepo{
+		store: store,
+	}
+}
+
+// FindByID is method to find user by id without locking it
+func (repo *MemoryUserRepo) FindByID(ctx context.Context, db *gorm.DB, ID int64) (user models.User, err error) {
+	err = repo.store.statement(ctx, db, func(t *memoryTx) error {
+		user, err = repo.store.user(t, ID)
+		return err
+	})
+	if err != nil {
+		logError(ctx, "FindByID", err)
+	}
+
+	return user, err
+}
+
+// LockByID is method to find user by id and lock its row until the transaction of db ends
+func (repo *MemoryUserRepo) LockByID(ctx context.Context, db *gorm.DB, ID int64) (user models.User, err error) {
+	err = repo.store.statement(ctx, db, func(t *memoryTx) error {
+		if err := repo.store.lock(ctx, t, ID); err != nil {
+			return err
+		}
+		user, err = repo.store.user(t, ID)
+		return err
+	})
+	if err != nil {
+		logError(ctx, "LockByID", err)
+	}
+
+	return user, err
+}
+
+// AddBalance is method to add amount to user balance, a negative amount deducts it
+func (repo *MemoryUserRepo) AddBalance(ctx context.Context, db *gorm.DB, ID int64, amount float64) error {
+	_, err := repo.addBalance(ctx, db, ID, amount, nil)
+	if err != nil {
+		logError(ctx, "AddBalance", err)
+	}
+
+	return err
+}
+
+// AddBalanceIfVersion is method to add amount to user balance only when the user is still at version.
+// It returns false when another transaction changed the user since it was read.
+func (repo *MemoryUserRepo) AddBalanceIfVersion(ctx context.Context, db *gorm.DB, ID int64, amount float64, version int64) (bool, error) {
+	applied, err := repo.addBalance(ctx, db, ID, amount, &version)
+	if err != nil {
+		logError(ctx, "AddBalanceIfVersion", err)
+	}
+
+	return applied, err
+}
+
+// addBalance is method to update the balance of user ID under its row lock, like an UPDATE it matches no row
+// when the user does not exist or, with version, is at another version
+func (repo *MemoryUserRepo) addBalance(ctx context.Context, db *gorm.DB, ID int64, amount float64, version *int64) (applied bool, err error) {
+	err = repo.store.statement(ctx, db, func(t *memoryTx) error {
+		if err := repo.store.lock(ctx, t, ID); err != nil {
+			return err
+		}
+
+		user, err := repo.store.user(t, ID)
+		if err != nil || (version != nil && user.Version != *version) {
+			return nil
+		}
+
+		user.Balance += amount
+		user.Version++
+		t.users[ID] = user
+		applied = true
+		return nil
+	})
+
+	return applied, err
+}
+
+// MemoryTransactionRepo services.TransactionProcessor on MemoryStore
+type MemoryTransactionRepo struct {
+	store *MemoryStore
+}
+
+// NewMemoryTransactionRepo initiate MemoryTransactionRepo
+func NewMemoryTransactionRepo(store *MemoryStore) *MemoryTransactionRepo {
+	return &MemoryTransactionRepo{
+		store: store,
+	}
+}
+
+// Insert is method to insert trx, its ID is taken even when the transaction rolls back like an auto increment
+func (repo *MemoryTransactionRepo) Insert(ctx context.Context, db *gorm.DB, transaction models.Transaction) (models.Transaction, error) {
+	err := repo.store.statement(ctx, db, func(t *memoryTx) error {
+		repo.store.mu.Lock()
+		repo.store.lastTrxID++
+		transaction.ID = repo.store.lastTrxID
+		repo.store.mu.Unlock()
+
+		if transaction.CreatedAt.IsZero() {
+			transaction.CreatedAt = time.Now()
+		}
+		transaction.Metadata = maps.Clone(transaction.Metadata)
+		t.transactions = append(t.transactions, transaction)
+		return nil
+	})
+	if err != nil {
+		logError(ctx, "Insert", err)
+	}
+
+	return transaction, err
+}
+
+// List is method to find transactions by filter, newest first
+func (repo *MemoryTransactionRepo) List(ctx context.Context, db *gorm.DB, filter models.TransactionFilter) ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	err := repo.store.statement(ctx, db, func(t *memoryTx) error {
+		repo.store.mu.Lock()
+		all := append(append([]models.Transaction(nil), repo.store.transactions...), t.transactions...)
+		repo.store.mu.Unlock()
+
+		sort.Slice(all, func(i, j int) bool { return all[i].ID > all[j].ID })
+		for _, transaction := range all {
+			if matchTransaction(transaction, filter) {
+				transactions = append(transactions, transaction)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logError(ctx, "List", err)
+		return nil, err
+	}
+
+	transactions = transactions[min(filter.Offset, len(transactions)):]
+	if filter.Limit > 0 && filter.Limit < len(transactions) {
+		transactions = transactions[:filter.Limit]
+	}
+
+	return transactions, nil
+}
+
+// matchTransaction whether transaction passes filter
+func matchTransaction(transaction models.Transaction, filter models.TransactionFilter) bool {
+	switch {
+	case filter.UserID != 0 && transaction.UserID != filter.UserID,
+		filter.Type != "" && transaction.Type != filter.Type,
+		filter.Reference != "" && transaction.Reference != filter.Reference,
+		filter.Category != "" && transaction.Category != filter.Category:
+		return false
+	}
+
+	if filter.MetaKey == "" {
+		return true
+	}
+	value, ok := transaction.Metadata[filter.MetaKey]
+	return ok && (filter.MetaValue == "" || value == filter.MetaValue)
+}
@@ -0,0 +1,12 @@
+package repositories
+
+import (
+	"context"
+	"wyvern-api/utils"
+)
+
+// logError log failed statement of repository method name with the request id and trace id of ctx
+func logError(ctx context.Context, name string, err error) {
+	log := utils.NewLoggerFromContext(ctx, name, 2).Repository()
+	log.Warn("failed %s, error: %s", name, err.Error())
+}
@@ -0,0 +1,36 @@
+package repositories
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"wyvern-api/models"
+)
+
+// RuntimeSettingRepo struct
+type RuntimeSettingRepo struct {
+	db *gorm.DB
+}
+
+// NewRuntimeSettingRepo initiate RuntimeSettingRepo
+func NewRuntimeSettingRepo(db *gorm.DB) *RuntimeSettingRepo {
+	return &RuntimeSettingRepo{
+		db: db,
+	}
+}
+
+// All is method to list every runtime setting by name
+func (repo *RuntimeSettingRepo) All(ctx context.Context, db *gorm.DB) (map[string]string, error) {
+	var settings []models.RuntimeSetting
+	result := db.WithContext(ctx).Order("name").Find(&settings)
+	if result.Error != nil {
+		logError(ctx, "All", result.Error)
+		return nil, result.Error
+	}
+
+	values := make(map[string]string, len(settings))
+	for _, setting := range settings {
+		values[setting.Name] = setting.Value
+	}
+
+	return values, nil
+}
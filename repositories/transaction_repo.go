@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"gorm.io/gorm"
 	"wyvern-api/models"
 )
@@ -17,16 +18,68 @@ func NewTransactionRepo(db *gorm.DB) *TransactionRepo {
 	}
 }
 
-// Insert is method to insert trx
-func (repo *TransactionRepo) Insert(db *gorm.DB, transaction models.Transaction) (models.Transaction, error) {
-	result := db.Create(&transaction)
+// Insert is method to insert trx and its metadata index
+func (repo *TransactionRepo) Insert(ctx context.Context, db *gorm.DB, transaction models.Transaction) (models.Transaction, error) {
+	result := db.WithContext(ctx).Create(&transaction)
 	if result.Error != nil {
+		logError(ctx, "Insert", result.Error)
+		return transaction, result.Error
+	}
+
+	if len(transaction.Metadata) == 0 {
+		return transaction, nil
+	}
+
+	metadata := make([]models.TransactionMetadata, 0, len(transaction.Metadata))
+	for key, value := range transaction.Metadata {
+		metadata = append(metadata, models.TransactionMetadata{
+			TransactionID: transaction.ID,
+			MetaKey:       key,
+			MetaValue:     value,
+		})
+	}
+	result = db.WithContext(ctx).Create(&metadata)
+	if result.Error != nil {
+		logError(ctx, "Insert", result.Error)
 		return transaction, result.Error
 	}
 
 	return transaction, nil
 }
 
+// List is method to find transactions by filter, newest first
+func (repo *TransactionRepo) List(ctx context.Context, db *gorm.DB, filter models.TransactionFilter) ([]models.Transaction, error) {
+	query := db.WithContext(ctx).Model(&models.Transaction{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Reference != "" {
+		query = query.Where("reference = ?", filter.Reference)
+	}
+	if filter.Category != "" {
+		query = query.Where("category = ?", filter.Category)
+	}
+	if filter.MetaKey != "" {
+		metadata := db.Model(&models.TransactionMetadata{}).Select("transaction_id").Where("meta_key = ?", filter.MetaKey)
+		if filter.MetaValue != "" {
+			metadata = metadata.Where("meta_value = ?", filter.MetaValue)
+		}
+		query = query.Where("id IN (?)", metadata)
+	}
+
+	var transactions []models.Transaction
+	result := query.Order("id DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&transactions)
+	if result.Error != nil {
+		logError(ctx, "List", result.Error)
+		return transactions, result.Error
+	}
+
+	return transactions, nil
+}
+
 func (repo *TransactionRepo) Credit(amount float64) {
 
 }
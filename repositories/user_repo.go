@@ -1,8 +1,9 @@
 package repositories
 
 import (
+	"context"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
+	"wyvern-api/dialects"
 	"wyvern-api/models"
 )
 
@@ -18,11 +19,12 @@ func NewUserRepo(db *gorm.DB) *UserRepo {
 	}
 }
 
-// FindByID is method to find user by id
-func (repo *UserRepo) FindByID(ID int64) (models.User, error) {
+// FindByID is method to find user by id without locking it
+func (repo *UserRepo) FindByID(ctx context.Context, db *gorm.DB, ID int64) (models.User, error) {
 	var user models.User
-	result := repo.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, ID)
+	result := db.WithContext(ctx).First(&user, ID)
 	if result.Error != nil {
+		logError(ctx, "FindByID", result.Error)
 		return user, result.Error
 	}
 
@@ -30,10 +32,80 @@ func (repo *UserRepo) FindByID(ID int64) (models.User, error) {
 }
 
 // Update is method to update user
-func (repo *UserRepo) Update(db *gorm.DB, user models.User) (models.User, error) {
-	result := db.Save(&user)
+func (repo *UserRepo) Update(ctx context.Context, db *gorm.DB, user models.User) (models.User, error) {
+	result := db.WithContext(ctx).Save(&user)
 	if result.Error != nil {
+		logError(ctx, "Update", result.Error)
 		return user, result.Error
 	}
 	return user, nil
 }
+
+// LockByID is method to find user by id and lock its row until the transaction of db ends
+func (repo *UserRepo) LockByID(ctx context.Context, db *gorm.DB, ID int64) (models.User, error) {
+	var user models.User
+	result := db.WithContext(ctx).Scopes(dialects.Lock("UPDATE", false)).First(&user, ID)
+	if result.Error != nil {
+		logError(ctx, "LockByID", result.Error)
+		return user, result.Error
+	}
+
+	return user, nil
+}
+
+// AddBalance is method to add amount to user balance, a negative amount deducts it
+func (repo *UserRepo) AddBalance(ctx context.Context, db *gorm.DB, ID int64, amount float64) error {
+	result := db.WithContext(ctx).Model(&models.User{}).Where("id = ?", ID).Updates(map[string]any{
+		"balance": gorm.Expr("balance + ?", amount),
+		"version": gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		logError(ctx, "AddBalance", result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+// AddBalanceIfVersion is method to add amount to user balance only when the user is still at version.
+// It returns false when another transaction changed the user since it was read.
+func (repo *UserRepo) AddBalanceIfVersion(ctx context.Context, db *gorm.DB, ID int64, amount float64, version int64) (bool, error) {
+	result := db.WithContext(ctx).Model(&models.User{}).Where("id = ? AND version = ?", ID, version).Updates(map[string]any{
+		"balance": gorm.Expr("balance + ?", amount),
+		"version": gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		logError(ctx, "AddBalanceIfVersion", result.Error)
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// ShareLockByID is method to find user by id and hold a shared lock on its row until the transaction of db ends.
+// Readers holding it do not block each other, only a writer locking the row for update.
+func (repo *UserRepo) ShareLockByID(ctx context.Context, db *gorm.DB, ID int64) (models.User, error) {
+	var user models.User
+	result := db.WithContext(ctx).Scopes(dialects.Lock("SHARE", false)).First(&user, ID)
+	if result.Error != nil {
+		logError(ctx, "ShareLockByID", result.Error)
+		return user, result.Error
+	}
+
+	return user, nil
+}
+
+// SetShardCount is method to set how many shards hold the balance of user, and what stays in users.balance
+func (repo *UserRepo) SetShardCount(ctx context.Context, db *gorm.DB, ID int64, shardCount int, balance float64) error {
+	result := db.WithContext(ctx).Model(&models.User{}).Where("id = ?", ID).Updates(map[string]any{
+		"shard_count": shardCount,
+		"balance":     balance,
+		"version":     gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		logError(ctx, "SetShardCount", result.Error)
+		return result.Error
+	}
+
+	return nil
+}
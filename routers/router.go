@@ -2,15 +2,64 @@ package routers
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"wyvern-api/controllers"
+	"wyvern-api/metrics"
+	"wyvern-api/middlewares"
+	"wyvern-api/utils"
 )
 
+// Services what the routes serve and how, built once by app.New; tests can pass fakes for any of them
+type Services struct {
+	Transactions controllers.TransactionService
+	Adjustments  controllers.AdjustmentService
+	Health       controllers.HealthService
+
+	// RateLimitEnabled rate limit the /api routes
+	RateLimitEnabled bool
+	// TrustedProxies IPs or CIDRs whose X-Forwarded-For is believed for the client IP
+	TrustedProxies []string
+	// OperatorKeys operator of each key accepted on /api/adjustments
+	OperatorKeys map[string]string
+	// ErrorFormat "problem" writes every error as application/problem+json
+	ErrorFormat string
+	// TracingServiceName service name of the request spans
+	TracingServiceName string
+}
+
 // Routes initiate router
-func Routes(route *gin.Engine) {
-	transactionController := controllers.NewTransactionController()
+func Routes(route *gin.Engine, svc Services) {
+	transactionController := controllers.NewTransactionController(svc.Transactions)
+	adjustmentController := controllers.NewAdjustmentController(svc.Adjustments)
+	healthController := controllers.NewHealthController(svc.Health)
+
+	// without trusted proxies X-Forwarded-For is ignored, a client can not pick its own IP for the IP rate limit
+	if err := route.SetTrustedProxies(svc.TrustedProxies); err != nil {
+		utils.NewLogger("Routes", 0).Error("invalid TRUSTED_PROXIES, trusting none, error: %s", err.Error())
+		_ = route.SetTrustedProxies(nil)
+	}
+
+	route.Use(middlewares.Tracing(svc.TracingServiceName), middlewares.ErrorFormat(svc.ErrorFormat), middlewares.RequestID(), middlewares.TraceResponse(), middlewares.Metrics())
+	route.GET("/metrics", gin.WrapH(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})))
+	route.GET("/healthz", healthController.Liveness)
+	route.GET("/readyz", healthController.Readiness)
+	route.GET("/status", healthController.Status)
 
 	api := route.Group("/api")
+	if svc.RateLimitEnabled {
+		api.Use(middlewares.RateLimiter(middlewares.NewMemoryRateLimitStore(), middlewares.DefaultRateLimitRules))
+	}
+
 	transaction := api.Group("/transactions")
+	transaction.GET("", transactionController.History)
 	transaction.POST("/credit", transactionController.Credit)
 	transaction.POST("/debit", transactionController.Debit)
+
+	// only operators holding a key of ADJUSTMENT_OPERATOR_KEYS, the key tells who proposes or reviews
+	adjustment := api.Group("/adjustments", middlewares.Operator(svc.OperatorKeys))
+	adjustment.POST("", adjustmentController.Propose)
+	adjustment.GET("", adjustmentController.List)
+	adjustment.GET("/:id", adjustmentController.Get)
+	adjustment.POST("/:id/approve", adjustmentController.Approve)
+	adjustment.POST("/:id/reject", adjustmentController.Reject)
 }
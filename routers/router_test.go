@@ -0,0 +1,156 @@
+package routers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wyvern-api/config"
+	"wyvern-api/middlewares"
+	"wyvern-api/models"
+	"wyvern-api/validators"
+)
+
+type fakeTransactions struct {
+	credits []models.CreditRequest
+}
+
+func (f *fakeTransactions) Credit(_ context.Context, req models.CreditRequest) (models.CreditResponse, error) {
+	f.credits = append(f.credits, req)
+	return models.CreditResponse{TransactionID: 7, NewBalance: req.Amount}, nil
+}
+
+func (f *fakeTransactions) Debit(context.Context, models.DebitRequest) (models.DebitResponse, error) {
+	return models.DebitResponse{}, models.ErrInsufficientFunds
+}
+
+func (f *fakeTransactions) History(context.Context, models.TransactionFilter) ([]models.Transaction, error) {
+	return nil, nil
+}
+
+type fakeAdjustments struct{}
+
+func (fakeAdjustments) Propose(_ context.Context, operator string, _ models.ProposeAdjustmentRequest) (models.Adjustment, error) {
+	return models.Adjustment{ProposedBy: operator}, nil
+}
+
+func (fakeAdjustments) Approve(context.Context, int64, string, models.ReviewAdjustmentRequest) (models.Adjustment, error) {
+	return models.Adjustment{}, nil
+}
+
+func (fakeAdjustments) Reject(context.Context, int64, string, models.ReviewAdjustmentRequest) (models.Adjustment, error) {
+	return models.Adjustment{}, nil
+}
+
+func (fakeAdjustments) Get(context.Context, int64) (models.Adjustment, error) {
+	return models.Adjustment{}, models.ErrAdjustmentNotFound
+}
+
+func (fakeAdjustments) List(context.Context, models.AdjustmentFilter) ([]models.Adjustment, error) {
+	return nil, nil
+}
+
+type fakeHealth struct {
+	ready bool
+}
+
+func (f fakeHealth) Readiness(context.Context) (models.HealthReport, bool) {
+	return models.HealthReport{}, f.ready
+}
+
+func (f fakeHealth) Status(context.Context) models.StatusReport {
+	return models.StatusReport{}
+}
+
+// newFakeRouter routes on fake services, no database behind them
+func newFakeRouter(t *testing.T, transactions *fakeTransactions, ready bool) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{TransactionMaxAmount: 1000, TransactionAmountPrecision: 2}
+	validators.Register(func() *config.Config { return cfg })
+
+	route := gin.New()
+	Routes(route, Services{
+		Transactions: transactions,
+		Adjustments:  fakeAdjustments{},
+		Health:       fakeHealth{ready: ready},
+		OperatorKeys: map[string]string{"alice-key-0123456789": "alice"},
+	})
+	return route
+}
+
+func serve(route *gin.Engine, method string, path string, body string, headers ...string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	route.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestRoutes(t *testing.T) {
+	t.Run("credit reaches the transaction service", func(t *testing.T) {
+		transactions := &fakeTransactions{}
+		recorder := serve(newFakeRouter(t, transactions, true), http.MethodPost, "/api/transactions/credit", `{"user_id": 1, "amount": 10}`)
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+		}
+		if len(transactions.credits) != 1 || transactions.credits[0].UserID != 1 {
+			t.Errorf("expected one credit of user 1, got %v", transactions.credits)
+		}
+		var resp struct {
+			Data models.CreditResponse `json:"data"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil || resp.Data.TransactionID != 7 {
+			t.Errorf("expected transaction 7, got %s", recorder.Body.String())
+		}
+	})
+
+	t.Run("service error mapped to its status", func(t *testing.T) {
+		recorder := serve(newFakeRouter(t, &fakeTransactions{}, true), http.MethodPost, "/api/transactions/debit", `{"user_id": 1, "amount": 10}`)
+		if recorder.Code != models.ErrInsufficientFunds.Status {
+			t.Errorf("expected %d, got %d", models.ErrInsufficientFunds.Status, recorder.Code)
+		}
+	})
+
+	t.Run("invalid request never reaches the service", func(t *testing.T) {
+		transactions := &fakeTransactions{}
+		recorder := serve(newFakeRouter(t, transactions, true), http.MethodPost, "/api/transactions/credit", `{"user_id": 1, "amount": -1}`)
+		if recorder.Code != http.StatusBadRequest || len(transactions.credits) != 0 {
+			t.Errorf("expected 400 without credit, got %d, %v", recorder.Code, transactions.credits)
+		}
+	})
+
+	t.Run("adjustments need an operator key", func(t *testing.T) {
+		route := newFakeRouter(t, &fakeTransactions{}, true)
+		proposal := `{"user_id": 1, "type": "CREDIT", "amount": 10, "reason": "refund"}`
+
+		for _, key := range []string{"", "guess-key-0123456789"} {
+			recorder := serve(route, http.MethodPost, "/api/adjustments", proposal, middlewares.OperatorKeyHeader, key, "X-Operator-ID", "alice")
+			if recorder.Code != http.StatusUnauthorized {
+				t.Errorf("key %q: expected 401, got %d", key, recorder.Code)
+			}
+		}
+
+		recorder := serve(route, http.MethodPost, "/api/adjustments", proposal, middlewares.OperatorKeyHeader, "alice-key-0123456789")
+		var resp struct {
+			Data models.Adjustment `json:"data"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil || recorder.Code != http.StatusOK || resp.Data.ProposedBy != "alice" {
+			t.Errorf("expected proposal by alice, got %d: %s", recorder.Code, recorder.Body.String())
+		}
+	})
+
+	t.Run("readiness from the health service", func(t *testing.T) {
+		recorder := serve(newFakeRouter(t, &fakeTransactions{}, false), http.MethodGet, "/readyz", "")
+		if recorder.Code != models.ErrNotReady.Status {
+			t.Errorf("expected %d, got %d", models.ErrNotReady.Status, recorder.Code)
+		}
+	})
+}
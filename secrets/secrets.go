@@ -0,0 +1,175 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Prefixes of a config value that is not the secret itself
+const (
+	// EncryptedPrefix AES-256-GCM ciphertext, base64 of nonce followed by the sealed value
+	EncryptedPrefix = "enc:"
+	// FilePrefix path of a file holding the secret, e.g. a docker or kubernetes secret
+	FilePrefix = "file:"
+)
+
+// Environment variables holding the key, SECRETS_KEY wins when both are set
+const (
+	KeyEnv     = "SECRETS_KEY"
+	KeyFileEnv = "SECRETS_KEY_FILE"
+)
+
+// KeySize bytes of a key, AES-256
+const KeySize = 32
+
+// ErrNoKey no key in SECRETS_KEY or SECRETS_KEY_FILE to decrypt with
+var ErrNoKey = errors.New("no secrets key, set " + KeyEnv + " or " + KeyFileEnv)
+
+// Cipher encrypt and decrypt enc: values with one key
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher initiate Cipher with a KeySize bytes key
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secrets key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt is method to seal plaintext under a random nonce into an enc: value
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return EncryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt is method to open an enc: value, it fails when the value was encrypted with another key or altered
+func (c *Cipher) Decrypt(value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, EncryptedPrefix)
+	if !ok {
+		return "", fmt.Errorf("value is not %s prefixed", EncryptedPrefix)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("invalid encrypted value: too short")
+	}
+
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("failed decrypt value, wrong key or altered ciphertext")
+	}
+
+	return string(plaintext), nil
+}
+
+// GenerateKey new random key, base64 encoded as SECRETS_KEY expects it
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKey decode a base64 key
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("secrets key is not base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secrets key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	return key, nil
+}
+
+// ReadKeyFile read the base64 key of a file
+func ReadKeyFile(path string) ([]byte, error) {
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseKey(string(encoded))
+}
+
+// LoadCipher initiate Cipher with the key of SECRETS_KEY or SECRETS_KEY_FILE, ErrNoKey when neither is set
+func LoadCipher() (*Cipher, error) {
+	var key []byte
+	var err error
+	switch {
+	case os.Getenv(KeyEnv) != "":
+		key, err = ParseKey(os.Getenv(KeyEnv))
+	case os.Getenv(KeyFileEnv) != "":
+		key, err = ReadKeyFile(os.Getenv(KeyFileEnv))
+	default:
+		return nil, ErrNoKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCipher(key)
+}
+
+// Resolver turn config values into secrets, the key is loaded on the first enc: value only,
+// so a config without encrypted values needs no key
+type Resolver struct {
+	cipher *Cipher
+}
+
+// NewResolver initiate Resolver, cipher may be nil to load it from the environment when needed
+func NewResolver(cipher *Cipher) *Resolver {
+	return &Resolver{cipher: cipher}
+}
+
+// Resolve is method to decrypt an enc: value or read a file: value, any other value is the secret itself
+func (r *Resolver) Resolve(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, EncryptedPrefix):
+		if r.cipher == nil {
+			cipher, err := LoadCipher()
+			if err != nil {
+				return "", err
+			}
+			r.cipher = cipher
+		}
+		return r.cipher.Decrypt(value)
+	case strings.HasPrefix(value, FilePrefix):
+		content, err := os.ReadFile(strings.TrimPrefix(value, FilePrefix))
+		if err != nil {
+			return "", err
+		}
+		// editors and echo leave a trailing newline
+		return strings.TrimRight(string(content), "\r\n"), nil
+	default:
+		return value, nil
+	}
+}
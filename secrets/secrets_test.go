@@ -0,0 +1,133 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestCipher(t *testing.T) (*Cipher, string) {
+	t.Helper()
+	encoded, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cipher, encoded
+}
+
+func TestCipher(t *testing.T) {
+	cipher, _ := newTestCipher(t)
+
+	t.Run("decrypt what was encrypted", func(t *testing.T) {
+		encrypted, err := cipher.Encrypt("s3cret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(encrypted, EncryptedPrefix) || strings.Contains(encrypted, "s3cret") {
+			t.Fatalf("unexpected ciphertext %q", encrypted)
+		}
+
+		plaintext, err := cipher.Decrypt(encrypted)
+		if err != nil || plaintext != "s3cret" {
+			t.Errorf("expected s3cret, got %q, %v", plaintext, err)
+		}
+	})
+
+	t.Run("random nonce per encryption", func(t *testing.T) {
+		first, _ := cipher.Encrypt("s3cret")
+		second, _ := cipher.Encrypt("s3cret")
+		if first == second {
+			t.Error("expected different ciphertexts")
+		}
+	})
+
+	t.Run("fail with another key", func(t *testing.T) {
+		other, _ := newTestCipher(t)
+		encrypted, _ := other.Encrypt("s3cret")
+		if _, err := cipher.Decrypt(encrypted); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("fail on altered ciphertext", func(t *testing.T) {
+		encrypted, _ := cipher.Encrypt("s3cret")
+		altered := encrypted[:len(encrypted)-4] + "AAA="
+		if _, err := cipher.Decrypt(altered); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("reject keys of the wrong size", func(t *testing.T) {
+		if _, err := NewCipher(make([]byte, 16)); err == nil {
+			t.Error("expected error")
+		}
+		if _, err := ParseKey("c2hvcnQ="); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestResolver(t *testing.T) {
+	cipher, encoded := newTestCipher(t)
+	encrypted, _ := cipher.Encrypt("s3cret")
+
+	t.Run("plain value is the secret", func(t *testing.T) {
+		value, err := NewResolver(nil).Resolve("plain")
+		if err != nil || value != "plain" {
+			t.Errorf("expected plain, got %q, %v", value, err)
+		}
+	})
+
+	t.Run("file value without trailing newline", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "db_pw")
+		if err := os.WriteFile(path, []byte("s3cret\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		value, err := NewResolver(nil).Resolve(FilePrefix + path)
+		if err != nil || value != "s3cret" {
+			t.Errorf("expected s3cret, got %q, %v", value, err)
+		}
+	})
+
+	t.Run("encrypted value with SECRETS_KEY", func(t *testing.T) {
+		t.Setenv(KeyEnv, encoded)
+		value, err := NewResolver(nil).Resolve(encrypted)
+		if err != nil || value != "s3cret" {
+			t.Errorf("expected s3cret, got %q, %v", value, err)
+		}
+	})
+
+	t.Run("encrypted value with SECRETS_KEY_FILE", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "key")
+		if err := os.WriteFile(path, []byte(encoded+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv(KeyEnv, "")
+		t.Setenv(KeyFileEnv, path)
+
+		value, err := NewResolver(nil).Resolve(encrypted)
+		if err != nil || value != "s3cret" {
+			t.Errorf("expected s3cret, got %q, %v", value, err)
+		}
+	})
+
+	t.Run("encrypted value without key", func(t *testing.T) {
+		t.Setenv(KeyEnv, "")
+		t.Setenv(KeyFileEnv, "")
+		if _, err := NewResolver(nil).Resolve(encrypted); !errors.Is(err, ErrNoKey) {
+			t.Errorf("expected ErrNoKey, got %v", err)
+		}
+	})
+}
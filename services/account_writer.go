@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+	"wyvern-api/config"
+	"wyvern-api/metrics"
+	"wyvern-api/models"
+	"wyvern-api/utils"
+)
+
+// AccountWriter serialize credits/debits per user on sharded workers, one owner per account.
+// A worker takes every operation queued on its shard into one database transaction, in queue order,
+// and still answers each operation on its own.
+type AccountWriter struct {
+	tp       TransactionProcessor
+	strategy BalanceStrategy
+	runner   TxRunner
+	shards   []*writerShard
+	maxBatch int
+	// txTimeout deadline of the transaction of one batch
+	txTimeout time.Duration
+}
+
+// writerShard queue of one worker, exited is closed after the worker drained it on shutdown
+type writerShard struct {
+	ops    chan *writeOp
+	exited chan struct{}
+}
+
+// writeOp one credit/debit, or unit of work, waiting for its worker
+type writeOp struct {
+	ctx         context.Context
+	transaction models.Transaction
+	delta       float64
+	// unit run instead of the credit/debit of delta when set
+	unit WriteUnit
+	done chan writeResult
+}
+
+// WriteUnit balance change run by the worker owning the user inside the transaction of its batch, returning the
+// recorded transaction and the new balance. A balance check must refuse before the unit writes anything, any other
+// error rolls the whole batch back. The unit may run again when its batch is retried op by op.
+type WriteUnit func(ctx context.Context, tx *gorm.DB) (models.Transaction, float64, error)
+
+// writeResult outcome of one writeOp
+type writeResult struct {
+	transaction models.Transaction
+	balance     float64
+	err         error
+}
+
+// NewAccountWriter initiate AccountWriter sized by SINGLE_WRITER_* of cfg, call Start before use
+func NewAccountWriter(cfg *config.Config, tp TransactionProcessor, strategy BalanceStrategy, runner TxRunner) *AccountWriter {
+	w := newAccountWriter(tp, strategy, runner, cfg.SingleWriterShards, cfg.SingleWriterMaxBatch, cfg.SingleWriterQueueSize)
+	w.txTimeout = cfg.DbTransactionTimeout
+	return w
+}
+
+func newAccountWriter(tp TransactionProcessor, strategy BalanceStrategy, runner TxRunner, shards int, maxBatch int, queueSize int) *AccountWriter {
+	if shards <= 0 {
+		shards = 1
+	}
+	if maxBatch <= 0 {
+		maxBatch = 1
+	}
+
+	w := &AccountWriter{
+		tp:       tp,
+		strategy: strategy,
+		runner:   runner,
+		shards:   make([]*writerShard, shards),
+		maxBatch: maxBatch,
+	}
+	for i := range w.shards {
+		w.shards[i] = &writerShard{
+			ops:    make(chan *writeOp, queueSize),
+			exited: make(chan struct{}),
+		}
+	}
+
+	return w
+}
+
+// Start is method to run one worker per shard until workers stop
+func (w *AccountWriter) Start(workers *utils.Workers) {
+	for i, shard := range w.shards {
+		shard := shard
+		workers.Go(fmt.Sprintf("AccountWriter-%d", i), func(ctx context.Context) {
+			w.run(ctx, shard)
+		})
+	}
+}
+
+// Submit is method to queue a credit/debit on the worker owning the user and wait for its result.
+// Once queued the operation is waited for even when ctx ends, so the answer always matches what was committed.
+func (w *AccountWriter) Submit(ctx context.Context, transaction models.Transaction, delta float64) (models.Transaction, float64, error) {
+	return w.submit(ctx, &writeOp{
+		ctx:         ctx,
+		transaction: transaction,
+		delta:       delta,
+		done:        make(chan writeResult, 1),
+	})
+}
+
+// SubmitUnit is method to queue unit, a balance change of the user of transaction, on the worker owning the user
+// and wait for its result, as Submit does
+func (w *AccountWriter) SubmitUnit(ctx context.Context, transaction models.Transaction, unit WriteUnit) (models.Transaction, float64, error) {
+	return w.submit(ctx, &writeOp{
+		ctx:         ctx,
+		transaction: transaction,
+		unit:        unit,
+		done:        make(chan writeResult, 1),
+	})
+}
+
+// submit is method to queue op on the shard of its user and wait for its result
+func (w *AccountWriter) submit(ctx context.Context, op *writeOp) (models.Transaction, float64, error) {
+	transaction := op.transaction
+	shard := w.shards[uint64(transaction.UserID)%uint64(len(w.shards))]
+
+	select {
+	case shard.ops <- op:
+	case <-shard.exited:
+		return transaction, 0, models.ErrNotReady
+	case <-ctx.Done():
+		return transaction, 0, dbError(ctx, ctx.Err(), models.ErrDatabase)
+	}
+
+	select {
+	case result := <-op.done:
+		return result.transaction, result.balance, result.err
+	case <-shard.exited:
+		// queued after the worker drained its shard for the last time
+		select {
+		case result := <-op.done:
+			return result.transaction, result.balance, result.err
+		default:
+			return transaction, 0, models.ErrNotReady
+		}
+	}
+}
+
+// run is method to process batches of shard until ctx is done, then drain what is still queued
+func (w *AccountWriter) run(ctx context.Context, shard *writerShard) {
+	defer close(shard.exited)
+
+	for {
+		select {
+		case op := <-shard.ops:
+			w.process(w.collect(op, shard))
+		case <-ctx.Done():
+			for {
+				select {
+				case op := <-shard.ops:
+					w.process(w.collect(op, shard))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// collect batch of first and what is already queued behind it, without waiting
+func (w *AccountWriter) collect(first *writeOp, shard *writerShard) []*writeOp {
+	batch := []*writeOp{first}
+	for len(batch) < w.maxBatch {
+		select {
+		case op := <-shard.ops:
+			batch = append(batch, op)
+		default:
+			return batch
+		}
+	}
+
+	return batch
+}
+
+// process is method to commit batch in one transaction. When the transaction fails as a whole and was rolled back,
+// each operation is run again alone, in order, so one bad operation does not fail the others. A failed commit is
+// never run again, its outcome is unknown and every operation of the batch gets its error.
+func (w *AccountWriter) process(batch []*writeOp) {
+	live := make([]*writeOp, 0, len(batch))
+	for _, op := range batch {
+		// the caller gave up before its turn, nothing was written for it
+		if err := op.ctx.Err(); err != nil {
+			op.done <- writeResult{transaction: op.transaction, err: dbError(op.ctx, err, models.ErrDatabase)}
+			continue
+		}
+		live = append(live, op)
+	}
+	if len(live) == 0 {
+		return
+	}
+	metrics.ObserveWriterBatch(len(live))
+
+	results, err := w.commit(live)
+	if err != nil && len(live) > 1 && !errors.Is(err, models.ErrCommitFailed) {
+		for _, op := range live {
+			w.process([]*writeOp{op})
+		}
+		return
+	}
+
+	for i, op := range live {
+		if err != nil {
+			results[i] = writeResult{transaction: op.transaction, err: err}
+		}
+		op.done <- results[i]
+	}
+}
+
+// commit is method to apply every op of batch in one transaction. An op refused by a balance check gets its own
+// error and is skipped, nothing was written for it, any other error fails the whole transaction.
+func (w *AccountWriter) commit(batch []*writeOp) ([]writeResult, error) {
+	// the batch does not belong to one request, so no caller can cancel it, it still carries the first trace
+	ctx, cancel := withTimeout(context.WithoutCancel(batch[0].ctx), w.txTimeout)
+	defer cancel()
+	ctx = utils.ContextWithTxType(ctx, DBTransactionTypeBatch)
+
+	results := make([]writeResult, len(batch))
+	err := w.runner.Run(ctx, func(tx *gorm.DB) error {
+		for i, op := range batch {
+			opCtx := utils.ContextWithRequestID(ctx, utils.RequestIDFromContext(op.ctx))
+
+			record, balance, err := w.execute(opCtx, tx, op)
+			if isRefused(err) {
+				results[i] = writeResult{transaction: op.transaction, err: err}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			results[i] = writeResult{transaction: record, balance: balance}
+		}
+		return nil
+	})
+
+	return results, err
+}
+
+// execute is method to run op inside tx, its unit or else the credit/debit of its delta
+func (w *AccountWriter) execute(ctx context.Context, tx *gorm.DB, op *writeOp) (models.Transaction, float64, error) {
+	if op.unit != nil {
+		return op.unit(ctx, tx)
+	}
+
+	log := utils.NewLoggerFromContext(ctx, "AccountWriter", 1).Service().AddField("user_id", op.transaction.UserID)
+
+	user, err := w.strategy.Apply(ctx, tx, op.transaction.UserID, op.delta)
+	if err != nil {
+		return op.transaction, 0, err
+	}
+
+	record, err := w.tp.Insert(ctx, tx, op.transaction)
+	if err != nil {
+		log.Warn("failed insert transaction, error: %s", err.Error())
+		return op.transaction, 0, dbError(ctx, err, models.ErrTransactionNotCreated)
+	}
+
+	return record, user.Balance, nil
+}
+
+// isRefused check whether a BalanceStrategy refused the change before writing anything
+func isRefused(err error) bool {
+	return errors.Is(err, models.ErrUserNotFound) || errors.Is(err, models.ErrAccountFrozen) || errors.Is(err, models.ErrInsufficientFunds)
+}
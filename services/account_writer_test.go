@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"wyvern-api/models"
+	"wyvern-api/repositories"
+)
+
+// drainedWriter single shard AccountWriter with ops queued before its worker runs, so they form one batch.
+// The worker runs until the queue is empty.
+func drainedWriter(t *testing.T, w *AccountWriter, ops ...*writeOp) {
+	t.Helper()
+	for _, op := range ops {
+		w.shards[0].ops <- op
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.run(ctx, w.shards[0])
+}
+
+func newWriteOp(ctx context.Context, userID int64, delta float64) *writeOp {
+	txType, amount := "CREDIT", delta
+	if delta < 0 {
+		txType, amount = "DEBIT", -delta
+	}
+
+	return &writeOp{
+		ctx:         ctx,
+		transaction: models.Transaction{UserID: userID, Amount: amount, Type: txType},
+		delta:       delta,
+		done:        make(chan writeResult, 1),
+	}
+}
+
+func TestAccountWriter_Batch(t *testing.T) {
+	db, mock := newSQLMock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(500, models.UserStatusActive))
+	mock.ExpectExec(addBalanceSQL).WithArgs(float64(100), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertTransaction).WillReturnResult(sqlmock.NewResult(21, 1))
+	mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(600, models.UserStatusActive))
+	mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(600, models.UserStatusActive))
+	mock.ExpectExec(addBalanceSQL).WithArgs(float64(50), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertTransaction).WillReturnResult(sqlmock.NewResult(22, 1))
+	mock.ExpectCommit()
+
+	w := newAccountWriter(repositories.NewTransactionRepo(db), NewPessimisticStrategy(repositories.NewUserRepo(db), 0), NewGormTxRunner(testConfig(), db), 1, 10, 10)
+	credit := newWriteOp(context.Background(), 1, 100)
+	overdraw := newWriteOp(context.Background(), 1, -1000)
+	credit2 := newWriteOp(context.Background(), 1, 50)
+	drainedWriter(t, w, credit, overdraw, credit2)
+
+	if result := <-credit.done; result.err != nil || result.transaction.ID != 21 || result.balance != 600 {
+		t.Errorf("expected transaction 21 with balance 600, got %+v", result)
+	}
+	if result := <-overdraw.done; !errors.Is(result.err, models.ErrInsufficientFunds) {
+		t.Errorf("expected %s, got %v", models.ErrInsufficientFunds.Code, result.err)
+	}
+	if result := <-credit2.done; result.err != nil || result.transaction.ID != 22 || result.balance != 650 {
+		t.Errorf("expected transaction 22 with balance 650, got %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAccountWriter_BatchFailureRunsEachAlone(t *testing.T) {
+	failure := errors.New("boom")
+
+	db, mock := newSQLMock(t)
+	// batch fails on the second insert and is rolled back
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(500, models.UserStatusActive))
+	mock.ExpectExec(addBalanceSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertTransaction).WillReturnResult(sqlmock.NewResult(31, 1))
+	mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(600, models.UserStatusActive))
+	mock.ExpectExec(addBalanceSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertTransaction).WillReturnError(failure)
+	mock.ExpectRollback()
+	// then each operation alone, in order
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(500, models.UserStatusActive))
+	mock.ExpectExec(addBalanceSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertTransaction).WillReturnResult(sqlmock.NewResult(32, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(600, models.UserStatusActive))
+	mock.ExpectExec(addBalanceSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertTransaction).WillReturnError(failure)
+	mock.ExpectRollback()
+
+	w := newAccountWriter(repositories.NewTransactionRepo(db), NewPessimisticStrategy(repositories.NewUserRepo(db), 0), NewGormTxRunner(testConfig(), db), 1, 10, 10)
+	first := newWriteOp(context.Background(), 1, 100)
+	second := newWriteOp(context.Background(), 1, 100)
+	drainedWriter(t, w, first, second)
+
+	if result := <-first.done; result.err != nil || result.transaction.ID != 32 {
+		t.Errorf("expected first committed alone as transaction 32, got %+v", result)
+	}
+	if result := <-second.done; !errors.Is(result.err, models.ErrTransactionNotCreated) {
+		t.Errorf("expected %s, got %v", models.ErrTransactionNotCreated.Code, result.err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAccountWriter_SkipsCanceled(t *testing.T) {
+	db, mock := newSQLMock(t)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := newAccountWriter(repositories.NewTransactionRepo(db), NewPessimisticStrategy(repositories.NewUserRepo(db), 0), NewGormTxRunner(testConfig(), db), 1, 10, 10)
+	op := newWriteOp(canceled, 1, 100)
+	drainedWriter(t, w, op)
+
+	if result := <-op.done; !errors.Is(result.err, models.ErrRequestCanceled) {
+		t.Errorf("expected %s, got %v", models.ErrRequestCanceled.Code, result.err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAccountWriter_SubmitAfterStop(t *testing.T) {
+	db, _ := newSQLMock(t)
+
+	w := newAccountWriter(repositories.NewTransactionRepo(db), NewPessimisticStrategy(repositories.NewUserRepo(db), 0), NewGormTxRunner(testConfig(), db), 2, 10, 10)
+	for _, shard := range w.shards {
+		drainedWriter(t, &AccountWriter{shards: []*writerShard{shard}})
+	}
+
+	_, _, err := w.Submit(context.Background(), models.Transaction{UserID: 1, Amount: 100, Type: "CREDIT"}, 100)
+	if !errors.Is(err, models.ErrNotReady) {
+		t.Errorf("expected %s, got %v", models.ErrNotReady.Code, err)
+	}
+}
+
+func TestAccountWriter_CommitFailureNotRerun(t *testing.T) {
+	db, mock := newSQLMock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(500, models.UserStatusActive))
+	mock.ExpectExec(addBalanceSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertTransaction).WillReturnResult(sqlmock.NewResult(41, 1))
+	mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(600, models.UserStatusActive))
+	mock.ExpectExec(addBalanceSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertTransaction).WillReturnResult(sqlmock.NewResult(42, 1))
+	// the commit may have gone through, nothing may run a second time
+	mock.ExpectCommit().WillReturnError(errors.New("connection lost"))
+
+	w := newAccountWriter(repositories.NewTransactionRepo(db), NewPessimisticStrategy(repositories.NewUserRepo(db), 0), NewGormTxRunner(testConfig(), db), 1, 10, 10)
+	first := newWriteOp(context.Background(), 1, 100)
+	second := newWriteOp(context.Background(), 1, 100)
+	drainedWriter(t, w, first, second)
+
+	for _, op := range []*writeOp{first, second} {
+		if result := <-op.done; !errors.Is(result.err, models.ErrCommitFailed) {
+			t.Errorf("expected %s, got %v", models.ErrCommitFailed.Code, result.err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,302 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+	"wyvern-api/config"
+	"wyvern-api/metrics"
+	"wyvern-api/models"
+	"wyvern-api/tracing"
+	"wyvern-api/utils"
+)
+
+// AdjustmentProcessor interface
+type AdjustmentProcessor interface {
+	Insert(ctx context.Context, db *gorm.DB, adjustment models.Adjustment) (models.Adjustment, error)
+	FindByID(ctx context.Context, db *gorm.DB, ID int64) (models.Adjustment, error)
+	Review(ctx context.Context, db *gorm.DB, ID int64, status string, reviewedBy string, note string, now time.Time) (bool, error)
+	Update(ctx context.Context, db *gorm.DB, adjustment models.Adjustment) (models.Adjustment, error)
+	List(ctx context.Context, db *gorm.DB, filter models.AdjustmentFilter, now time.Time) ([]models.Adjustment, error)
+}
+
+// AdjustmentService struct
+type AdjustmentService struct {
+	cfg    *config.Config
+	ap     AdjustmentProcessor
+	ts     *TransactionService
+	runner TxRunner
+	db     *gorm.DB
+}
+
+// NewAdjustmentService initiate AdjustmentService, an approval runs in one transaction of runner
+func NewAdjustmentService(cfg *config.Config, ap AdjustmentProcessor, ts *TransactionService, runner TxRunner, db *gorm.DB) *AdjustmentService {
+	return &AdjustmentService{
+		cfg:    cfg,
+		ap:     ap,
+		ts:     ts,
+		runner: runner,
+		db:     db,
+	}
+}
+
+// Propose is method for create a pending adjustment
+func (svc *AdjustmentService) Propose(ctx context.Context, operator string, req models.ProposeAdjustmentRequest) (adjustment models.Adjustment, err error) {
+	ctx, span := tracing.Start(ctx, "AdjustmentService.Propose")
+	defer func() { tracing.End(span, err) }()
+
+	log := utils.NewLoggerFromContext(ctx, "Propose", 1).Service().AddField("user_id", req.UserID)
+	log.Info("operator: %s, req: %s", operator, utils.Redact(req))
+
+	if err := validateProposal(operator, req); err != nil {
+		log.Warn("invalid proposal, error: %s", err.Error())
+		return models.Adjustment{}, err
+	}
+
+	now := time.Now()
+	adjustment = models.Adjustment{
+		UserID:     req.UserID,
+		Type:       req.Type,
+		Amount:     req.Amount,
+		Reason:     req.Reason,
+		Status:     models.AdjustmentStatusPending,
+		ProposedBy: operator,
+		ExpiresAt:  now.Add(svc.cfg.AdjustmentTTL),
+		CreatedAt:  now,
+	}
+	ctx, cancel := withTimeout(ctx, svc.cfg.DbQueryTimeout)
+	defer cancel()
+
+	adjustment, err = svc.ap.Insert(ctx, contextDB(svc.db, ctx), adjustment)
+	if err != nil {
+		log.Warn("failed insert adjustment, error: %s", err.Error())
+		return adjustment, dbError(ctx, err, models.ErrDatabase)
+	}
+
+	return adjustment, nil
+}
+
+// Approve is method for approve a pending adjustment and execute it
+func (svc *AdjustmentService) Approve(ctx context.Context, ID int64, operator string, req models.ReviewAdjustmentRequest) (adjustment models.Adjustment, err error) {
+	ctx, span := tracing.Start(ctx, "AdjustmentService.Approve")
+	defer func() { tracing.End(span, err) }()
+
+	log := utils.NewLoggerFromContext(ctx, "Approve", 1).Service()
+	log.Info("id: %d, operator: %s, req: %s", ID, operator, utils.Redact(req))
+
+	adjustment, err = svc.findReviewable(ctx, ID, operator)
+	if err != nil {
+		return adjustment, err
+	}
+
+	// four-eyes rule, nobody approves their own adjustment
+	if adjustment.ProposedBy == operator {
+		log.Warn("operator %s approve own adjustment %d", operator, ID)
+		return adjustment, models.ErrSelfApproval
+	}
+
+	defer func() { metrics.ObserveTransaction(adjustment.Type, adjustment.Amount, err) }()
+
+	// balance change, claim and outcome commit together, so an adjustment is never approved without its
+	// transaction nor money moved without the adjustment recording it. In single writer mode the worker owning
+	// the user runs them, like every other balance change of the user
+	now := time.Now()
+	delta := adjustment.Amount
+	if adjustment.Type == "DEBIT" {
+		delta = -delta
+	}
+	transaction := models.Transaction{UserID: adjustment.UserID, Amount: adjustment.Amount, Type: adjustment.Type}
+	var approved models.Adjustment
+	_, _, err = svc.ts.Execute(ctx, transaction, func(ctx context.Context, tx *gorm.DB) (models.Transaction, float64, error) {
+		// execute adjustment first, a refusing balance check must come before anything is written
+		record, balance, err := svc.ts.ExecuteTx(ctx, tx, transaction, delta)
+		if err != nil {
+			return transaction, 0, err
+		}
+
+		// claim the adjustment, so two approvers can not execute it twice
+		claimed, err := svc.ap.Review(ctx, tx, ID, models.AdjustmentStatusApproved, operator, req.Note, now)
+		if err != nil {
+			log.Warn("failed approve adjustment, error: %s", err.Error())
+			return transaction, 0, dbError(ctx, err, models.ErrDatabase)
+		}
+		if !claimed {
+			log.Warn("adjustment %d is no longer pending", ID)
+			return transaction, 0, models.ErrAdjustmentNotPending
+		}
+
+		result := adjustment
+		result.Status = models.AdjustmentStatusApproved
+		result.ReviewedBy = operator
+		result.ReviewNote = req.Note
+		result.ReviewedAt = &now
+		result.TransactionID = &record.ID
+		if result, err = svc.ap.Update(ctx, tx, result); err != nil {
+			log.Warn("failed update adjustment, error: %s", err.Error())
+			return transaction, 0, dbError(ctx, err, models.ErrDatabase)
+		}
+
+		approved = result
+		return record, balance, nil
+	})
+	if err == nil {
+		return approved, nil
+	}
+
+	// refused by a balance check, nothing was written and the adjustment can never succeed as proposed;
+	// any other error left it pending for another try
+	if isRefused(err) {
+		log.Warn("failed execute adjustment, error: %s", err.Error())
+		return svc.fail(ctx, adjustment, operator, req.Note, err)
+	}
+
+	return adjustment, err
+}
+
+// fail is method to move a pending adjustment to FAILED with the code of execErr, it returns execErr
+func (svc *AdjustmentService) fail(ctx context.Context, adjustment models.Adjustment, operator string, note string, execErr error) (models.Adjustment, error) {
+	log := utils.NewLoggerFromContext(ctx, "fail", 2).Service()
+
+	now := time.Now()
+	failed := adjustment
+	err := svc.runner.Run(ctx, func(tx *gorm.DB) error {
+		claimed, err := svc.ap.Review(ctx, tx, adjustment.ID, models.AdjustmentStatusFailed, operator, note, now)
+		if err != nil || !claimed {
+			return err
+		}
+
+		failed.Status = models.AdjustmentStatusFailed
+		failed.ReviewedBy = operator
+		failed.ReviewNote = note
+		failed.ReviewedAt = &now
+		failed.FailureReason = models.AsAppError(execErr).Code
+		failed, err = svc.ap.Update(ctx, tx, failed)
+		return err
+	})
+	if err != nil {
+		log.Error("failed record adjustment %d as failed, error: %s", adjustment.ID, err.Error())
+		return adjustment, execErr
+	}
+
+	return failed, execErr
+}
+
+// Reject is method for reject a pending adjustment
+func (svc *AdjustmentService) Reject(ctx context.Context, ID int64, operator string, req models.ReviewAdjustmentRequest) (adjustment models.Adjustment, err error) {
+	ctx, span := tracing.Start(ctx, "AdjustmentService.Reject")
+	defer func() { tracing.End(span, err) }()
+
+	log := utils.NewLoggerFromContext(ctx, "Reject", 1).Service()
+	log.Info("id: %d, operator: %s, req: %s", ID, operator, utils.Redact(req))
+
+	adjustment, err = svc.findReviewable(ctx, ID, operator)
+	if err != nil {
+		return adjustment, err
+	}
+
+	ctx, cancel := withTimeout(ctx, svc.cfg.DbQueryTimeout)
+	defer cancel()
+
+	now := time.Now()
+	claimed, err := svc.ap.Review(ctx, contextDB(svc.db, ctx), ID, models.AdjustmentStatusRejected, operator, req.Note, now)
+	if err != nil {
+		log.Warn("failed reject adjustment, error: %s", err.Error())
+		return adjustment, dbError(ctx, err, models.ErrDatabase)
+	}
+	if !claimed {
+		log.Warn("adjustment %d is no longer pending", ID)
+		return adjustment, models.ErrAdjustmentNotPending
+	}
+	adjustment.Status = models.AdjustmentStatusRejected
+	adjustment.ReviewedBy = operator
+	adjustment.ReviewNote = req.Note
+	adjustment.ReviewedAt = &now
+
+	return adjustment, nil
+}
+
+// Get is method for find adjustment by id, with its status at the time of the read
+func (svc *AdjustmentService) Get(ctx context.Context, ID int64) (adjustment models.Adjustment, err error) {
+	ctx, span := tracing.Start(ctx, "AdjustmentService.Get")
+	defer func() { tracing.End(span, err) }()
+
+	log := utils.NewLoggerFromContext(ctx, "Get", 1).Service()
+
+	ctx, cancel := withTimeout(ctx, svc.cfg.DbQueryTimeout)
+	defer cancel()
+
+	adjustment, err = svc.ap.FindByID(ctx, contextDB(svc.db, ctx), ID)
+	if err != nil {
+		log.Warn("failed find adjustment, error: %s", err.Error())
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return adjustment, models.ErrAdjustmentNotFound
+		}
+		return adjustment, dbError(ctx, err, models.ErrDatabase)
+	}
+	adjustment.Status = adjustment.StatusAt(time.Now())
+
+	return adjustment, nil
+}
+
+// List is method for query adjustment history, with the status of each at the time of the read
+func (svc *AdjustmentService) List(ctx context.Context, filter models.AdjustmentFilter) (adjustments []models.Adjustment, err error) {
+	ctx, span := tracing.Start(ctx, "AdjustmentService.List")
+	defer func() { tracing.End(span, err) }()
+
+	log := utils.NewLoggerFromContext(ctx, "List", 1).Service()
+	log.Info("filter: %+v", filter)
+
+	ctx, cancel := withTimeout(ctx, svc.cfg.DbQueryTimeout)
+	defer cancel()
+
+	if filter.Limit <= 0 || filter.Limit > 100 {
+		filter.Limit = 100
+	}
+	now := time.Now()
+	adjustments, err = svc.ap.List(ctx, contextDB(svc.db, ctx), filter, now)
+	if err != nil {
+		log.Warn("failed list adjustments, error: %s", err.Error())
+		return adjustments, dbError(ctx, err, models.ErrDatabase)
+	}
+	for i := range adjustments {
+		adjustments[i].Status = adjustments[i].StatusAt(now)
+	}
+
+	return adjustments, nil
+}
+
+// findReviewable find adjustment and make sure it still can be reviewed by operator
+func (svc *AdjustmentService) findReviewable(ctx context.Context, ID int64, operator string) (models.Adjustment, error) {
+	log := utils.NewLoggerFromContext(ctx, "findReviewable", 2).Service()
+
+	if operator == "" {
+		log.Warn("operator is required")
+		return models.Adjustment{}, models.ErrOperatorRequired
+	}
+
+	adjustment, err := svc.Get(ctx, ID)
+	if err != nil {
+		return adjustment, err
+	}
+
+	if adjustment.Status != models.AdjustmentStatusPending {
+		log.Warn("adjustment %d is already %s", ID, adjustment.Status)
+		return adjustment, models.ErrAdjustmentNotPending.WithMessage("Adjustment is already " + adjustment.Status)
+	}
+
+	return adjustment, nil
+}
+
+// validateProposal return error when proposal is invalid, field rules are checked on binding
+func validateProposal(operator string, req models.ProposeAdjustmentRequest) error {
+	if operator == "" {
+		return models.ErrOperatorRequired
+	}
+
+	if req.Type != "CREDIT" && req.Type != "DEBIT" {
+		return models.ErrInvalidRequest.WithMessage("Type must be CREDIT or DEBIT")
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"sync"
+	"testing"
+	"time"
+	"wyvern-api/migrations"
+	"wyvern-api/models"
+	"wyvern-api/repositories"
+	"wyvern-api/utils"
+)
+
+// newAdjustmentService AdjustmentService on a database holding user 1 with balance, tp nil for the real repository
+func newAdjustmentService(t *testing.T, balance float64, tp TransactionProcessor) (*AdjustmentService, *gorm.DB) {
+	t.Helper()
+	cfg := testConfig()
+
+	db := migrations.NewTestDB(t)
+	db.Create(&models.User{Username: "Fulan", Balance: balance})
+	if tp == nil {
+		tp = repositories.NewTransactionRepo(db)
+	}
+	ts := NewTransactionService(cfg, tp, NewPessimisticStrategy(repositories.NewUserRepo(db), 0), NewGormTxRunner(cfg, db), nil, db, nil)
+
+	return NewAdjustmentService(cfg, repositories.NewAdjustmentRepo(db), ts, NewGormTxRunner(cfg, db), db), db
+}
+
+func propose(t *testing.T, svc *AdjustmentService, txType string, amount float64) models.Adjustment {
+	t.Helper()
+	adjustment, err := svc.Propose(context.Background(), "alice", models.ProposeAdjustmentRequest{UserID: 1, Type: txType, Amount: amount, Reason: "refund"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return adjustment
+}
+
+// assertState adjustment status, user balance and number of transactions in db
+func assertState(t *testing.T, svc *AdjustmentService, db *gorm.DB, ID int64, status string, balance float64, transactions int64) {
+	t.Helper()
+	adjustment, err := svc.Get(context.Background(), ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var user models.User
+	db.First(&user, 1)
+	var count int64
+	db.Model(&models.Transaction{}).Count(&count)
+
+	if adjustment.Status != status || user.Balance != balance || count != transactions {
+		t.Errorf("expected %s, balance %v and %d transactions, got %s, %v and %d", status, balance, transactions, adjustment.Status, user.Balance, count)
+	}
+}
+
+func TestAdjustmentService_Approve(t *testing.T) {
+	t.Run("executes and records the transaction", func(t *testing.T) {
+		svc, db := newAdjustmentService(t, 100, nil)
+		adjustment := propose(t, svc, "DEBIT", 40)
+
+		approved, err := svc.Approve(context.Background(), adjustment.ID, "bob", models.ReviewAdjustmentRequest{Note: "ok"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if approved.Status != models.AdjustmentStatusApproved || approved.TransactionID == nil || approved.ReviewedBy != "bob" {
+			t.Errorf("expected approved by bob with a transaction, got %+v", approved)
+		}
+		assertState(t, svc, db, adjustment.ID, models.AdjustmentStatusApproved, 60, 1)
+
+		stored, _ := svc.Get(context.Background(), adjustment.ID)
+		if stored.TransactionID == nil || *stored.TransactionID != *approved.TransactionID {
+			t.Errorf("expected transaction %d recorded, got %v", *approved.TransactionID, stored.TransactionID)
+		}
+
+		if _, err := svc.Approve(context.Background(), adjustment.ID, "carol", models.ReviewAdjustmentRequest{}); !errors.Is(err, models.ErrAdjustmentNotPending) {
+			t.Errorf("expected %s on second approval, got %v", models.ErrAdjustmentNotPending.Code, err)
+		}
+		assertState(t, svc, db, adjustment.ID, models.AdjustmentStatusApproved, 60, 1)
+	})
+
+	t.Run("proposer can not approve, whatever the amount", func(t *testing.T) {
+		svc, db := newAdjustmentService(t, 100, nil)
+		adjustment := propose(t, svc, "CREDIT", 0.01)
+
+		if _, err := svc.Approve(context.Background(), adjustment.ID, "alice", models.ReviewAdjustmentRequest{}); !errors.Is(err, models.ErrSelfApproval) {
+			t.Fatalf("expected %s, got %v", models.ErrSelfApproval.Code, err)
+		}
+		assertState(t, svc, db, adjustment.ID, models.AdjustmentStatusPending, 100, 0)
+	})
+
+	t.Run("refused by the balance check fails the adjustment", func(t *testing.T) {
+		svc, db := newAdjustmentService(t, 100, nil)
+		adjustment := propose(t, svc, "DEBIT", 500)
+
+		failed, err := svc.Approve(context.Background(), adjustment.ID, "bob", models.ReviewAdjustmentRequest{})
+		if !errors.Is(err, models.ErrInsufficientFunds) {
+			t.Fatalf("expected %s, got %v", models.ErrInsufficientFunds.Code, err)
+		}
+		if failed.FailureReason != models.ErrInsufficientFunds.Code {
+			t.Errorf("expected failure reason %s, got %q", models.ErrInsufficientFunds.Code, failed.FailureReason)
+		}
+		assertState(t, svc, db, adjustment.ID, models.AdjustmentStatusFailed, 100, 0)
+	})
+
+	t.Run("failed insert leaves it pending", func(t *testing.T) {
+		svc, db := newAdjustmentService(t, 100, failingInserts{})
+		adjustment := propose(t, svc, "CREDIT", 10)
+
+		if _, err := svc.Approve(context.Background(), adjustment.ID, "bob", models.ReviewAdjustmentRequest{}); !errors.Is(err, models.ErrTransactionNotCreated) {
+			t.Fatalf("expected %s, got %v", models.ErrTransactionNotCreated.Code, err)
+		}
+		assertState(t, svc, db, adjustment.ID, models.AdjustmentStatusPending, 100, 0)
+	})
+}
+
+func TestAdjustmentService_Reject(t *testing.T) {
+	svc, db := newAdjustmentService(t, 100, nil)
+	adjustment := propose(t, svc, "CREDIT", 10)
+
+	rejected, err := svc.Reject(context.Background(), adjustment.ID, "bob", models.ReviewAdjustmentRequest{Note: "no ticket"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejected.Status != models.AdjustmentStatusRejected || rejected.ReviewNote != "no ticket" {
+		t.Errorf("expected rejected with note, got %+v", rejected)
+	}
+
+	if _, err := svc.Approve(context.Background(), adjustment.ID, "carol", models.ReviewAdjustmentRequest{}); !errors.Is(err, models.ErrAdjustmentNotPending) {
+		t.Errorf("expected %s, got %v", models.ErrAdjustmentNotPending.Code, err)
+	}
+	assertState(t, svc, db, adjustment.ID, models.AdjustmentStatusRejected, 100, 0)
+}
+
+func TestAdjustmentService_Expiry(t *testing.T) {
+	svc, db := newAdjustmentService(t, 100, nil)
+	svc.cfg.AdjustmentTTL = time.Millisecond
+	adjustment := propose(t, svc, "CREDIT", 10)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := svc.Approve(context.Background(), adjustment.ID, "bob", models.ReviewAdjustmentRequest{}); !errors.Is(err, models.ErrAdjustmentNotPending) {
+		t.Errorf("expected %s, got %v", models.ErrAdjustmentNotPending.Code, err)
+	}
+	assertState(t, svc, db, adjustment.ID, models.AdjustmentStatusExpired, 100, 0)
+
+	// reads derive the status, they write nothing
+	var stored models.Adjustment
+	db.First(&stored, adjustment.ID)
+	if stored.Status != models.AdjustmentStatusPending {
+		t.Errorf("expected stored status %s, got %s", models.AdjustmentStatusPending, stored.Status)
+	}
+
+	for status, expected := range map[string]int{models.AdjustmentStatusExpired: 1, models.AdjustmentStatusPending: 0} {
+		listed, err := svc.List(context.Background(), models.AdjustmentFilter{Status: status})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(listed) != expected {
+			t.Errorf("expected %d %s adjustments, got %+v", expected, status, listed)
+		}
+		for _, listedAdjustment := range listed {
+			if listedAdjustment.Status != status {
+				t.Errorf("expected %s, got %s", status, listedAdjustment.Status)
+			}
+		}
+	}
+}
+
+func TestAdjustmentService_OperatorRequired(t *testing.T) {
+	svc, _ := newAdjustmentService(t, 100, nil)
+	adjustment := propose(t, svc, "CREDIT", 10)
+
+	if _, err := svc.Approve(context.Background(), adjustment.ID, "", models.ReviewAdjustmentRequest{}); !errors.Is(err, models.ErrOperatorRequired) {
+		t.Errorf("expected %s, got %v", models.ErrOperatorRequired.Code, err)
+	}
+}
+
+// txTypes TxRunner recording the type label of every transaction it runs
+type txTypes struct {
+	TxRunner
+	mu    sync.Mutex
+	types []string
+}
+
+func (r *txTypes) Run(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	r.mu.Lock()
+	r.types = append(r.types, utils.TxTypeFromContext(ctx))
+	r.mu.Unlock()
+	return r.TxRunner.Run(ctx, fn)
+}
+
+func TestAdjustmentService_SingleWriter(t *testing.T) {
+	cfg := testConfig()
+	db := migrations.NewTestDB(t)
+	db.Create(&models.User{Username: "Fulan", Balance: 100})
+
+	strategy := NewPessimisticStrategy(repositories.NewUserRepo(db), 0)
+	writerRunner := &txTypes{TxRunner: NewGormTxRunner(cfg, db)}
+	workers := utils.NewWorkers()
+	defer workers.Stop(context.Background())
+	writer := NewAccountWriter(cfg, repositories.NewTransactionRepo(db), strategy, writerRunner)
+	writer.Start(workers)
+	ts := NewTransactionService(cfg, repositories.NewTransactionRepo(db), strategy, NewGormTxRunner(cfg, db), writer, db, nil)
+	svc := NewAdjustmentService(cfg, repositories.NewAdjustmentRepo(db), ts, NewGormTxRunner(cfg, db), db)
+
+	adjustment := propose(t, svc, "DEBIT", 40)
+	if _, err := svc.Approve(context.Background(), adjustment.ID, "bob", models.ReviewAdjustmentRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	assertState(t, svc, db, adjustment.ID, models.AdjustmentStatusApproved, 60, 1)
+	if len(writerRunner.types) != 1 || writerRunner.types[0] != DBTransactionTypeBatch {
+		t.Errorf("expected the approval committed in one writer batch, got %v", writerRunner.types)
+	}
+
+	overdraw := propose(t, svc, "DEBIT", 500)
+	if _, err := svc.Approve(context.Background(), overdraw.ID, "bob", models.ReviewAdjustmentRequest{}); !errors.Is(err, models.ErrInsufficientFunds) {
+		t.Fatalf("expected %s, got %v", models.ErrInsufficientFunds.Code, err)
+	}
+	assertState(t, svc, db, overdraw.ID, models.AdjustmentStatusFailed, 60, 1)
+
+	if _, err := svc.Approve(context.Background(), adjustment.ID, "carol", models.ReviewAdjustmentRequest{}); !errors.Is(err, models.ErrAdjustmentNotPending) {
+		t.Errorf("expected %s on second approval, got %v", models.ErrAdjustmentNotPending.Code, err)
+	}
+}
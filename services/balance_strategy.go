@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+	"wyvern-api/config"
+	"wyvern-api/metrics"
+	"wyvern-api/models"
+	"wyvern-api/utils"
+)
+
+// Balance strategy names for BALANCE_STRATEGY
+const (
+	BalanceStrategyPessimistic = "pessimistic"
+	BalanceStrategyOptimistic  = "optimistic"
+)
+
+// BalanceStrategy apply a balance change of one user inside tx, guarded against concurrent changes.
+// It returns the user with its new balance.
+type BalanceStrategy interface {
+	Apply(ctx context.Context, tx *gorm.DB, userID int64, delta float64) (models.User, error)
+}
+
+// NewBalanceStrategy initiate BalanceStrategy by name, a pessimistic one waits at most lockWaitTimeout for the row lock
+func NewBalanceStrategy(name string, up UserProcessor, lockWaitTimeout time.Duration) (BalanceStrategy, error) {
+	switch name {
+	case "", BalanceStrategyPessimistic:
+		return NewPessimisticStrategy(up, lockWaitTimeout), nil
+	case BalanceStrategyOptimistic:
+		return NewOptimisticStrategy(up), nil
+	}
+
+	return nil, fmt.Errorf("unknown BALANCE_STRATEGY %q", name)
+}
+
+// NewConfiguredBalanceStrategy initiate the BalanceStrategy named by BALANCE_STRATEGY of cfg,
+// wrapped in ShardedStrategy when BALANCE_SHARDING_ENABLED
+func NewConfiguredBalanceStrategy(cfg *config.Config, up ShardedUserProcessor, bp BalanceShardProcessor) (BalanceStrategy, error) {
+	strategy, err := NewBalanceStrategy(cfg.BalanceStrategy, up, cfg.DbLockWaitTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BalanceShardingEnabled {
+		strategy = NewShardedStrategy(strategy, up, bp, cfg.TransactionAmountPrecision)
+	}
+
+	return strategy, nil
+}
+
+// PessimisticStrategy lock the user row for the whole transaction, concurrent changes wait for it
+type PessimisticStrategy struct {
+	up              UserProcessor
+	lockWaitTimeout time.Duration
+}
+
+// NewPessimisticStrategy initiate PessimisticStrategy waiting at most lockWaitTimeout for the row lock, 0 for no limit
+func NewPessimisticStrategy(up UserProcessor, lockWaitTimeout time.Duration) *PessimisticStrategy {
+	return &PessimisticStrategy{
+		up:              up,
+		lockWaitTimeout: lockWaitTimeout,
+	}
+}
+
+// Apply implement BalanceStrategy
+func (s *PessimisticStrategy) Apply(ctx context.Context, tx *gorm.DB, userID int64, delta float64) (models.User, error) {
+	log := utils.NewLoggerFromContext(ctx, "PessimisticStrategy", 1).Service().AddField("user_id", userID)
+
+	// Lock the row to prevent concurrent updates, waiting at most DB_LOCK_WAIT_TIMEOUT
+	lockCtx, cancelLock := withTimeout(ctx, s.lockWaitTimeout)
+	defer cancelLock()
+	lockStart := time.Now()
+	user, err := s.up.LockByID(lockCtx, tx, userID)
+	metrics.ObserveLockWait(transactionType(delta), lockStart)
+	if err != nil {
+		return user, findUserError(lockCtx, log, userID, err)
+	}
+
+	if err := checkBalanceChange(log, user, delta); err != nil {
+		return user, err
+	}
+
+	// update user balance
+	if err := s.up.AddBalance(ctx, tx, user.ID, delta); err != nil {
+		log.Warn("failed update user, error: %s", err.Error())
+		return user, dbError(ctx, err, models.ErrDatabase)
+	}
+
+	user.Balance += delta
+	user.Version++
+	return user, nil
+}
+
+// OptimisticStrategy read the user without lock and update it only when its version is unchanged.
+// A concurrent change fails with ErrVersionConflict, the runner re-runs the transaction with a fresh read.
+type OptimisticStrategy struct {
+	up UserProcessor
+}
+
+// NewOptimisticStrategy initiate OptimisticStrategy
+func NewOptimisticStrategy(up UserProcessor) *OptimisticStrategy {
+	return &OptimisticStrategy{
+		up: up,
+	}
+}
+
+// Apply implement BalanceStrategy
+func (s *OptimisticStrategy) Apply(ctx context.Context, tx *gorm.DB, userID int64, delta float64) (models.User, error) {
+	log := utils.NewLoggerFromContext(ctx, "OptimisticStrategy", 1).Service().AddField("user_id", userID)
+
+	user, err := s.up.FindByID(ctx, tx, userID)
+	if err != nil {
+		return user, findUserError(ctx, log, userID, err)
+	}
+
+	if err := checkBalanceChange(log, user, delta); err != nil {
+		return user, err
+	}
+
+	// update user balance, only when nobody changed it since the read
+	applied, err := s.up.AddBalanceIfVersion(ctx, tx, user.ID, delta, user.Version)
+	if err != nil {
+		log.Warn("failed update user, error: %s", err.Error())
+		return user, dbError(ctx, err, models.ErrDatabase)
+	}
+	if !applied {
+		log.Warn("user %d changed since version %d", userID, user.Version)
+		return user, models.ErrVersionConflict
+	}
+
+	user.Balance += delta
+	user.Version++
+	return user, nil
+}
+
+// findUserError map failed user read to ErrUserNotFound or a database error
+func findUserError(ctx context.Context, log *utils.Logger, userID int64, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Warn("user %d not found", userID)
+		return models.ErrUserNotFound
+	}
+
+	log.Warn("failed find user, error: %s", err.Error())
+	return dbError(ctx, err, models.ErrDatabase)
+}
+
+// checkBalanceChange return error when user can not move delta
+func checkBalanceChange(log *utils.Logger, user models.User, delta float64) error {
+	// frozen account can not move money
+	if user.Status == models.UserStatusFrozen {
+		log.Warn("user %d is frozen", user.ID)
+		return models.ErrAccountFrozen
+	}
+
+	// validate balance
+	if user.Balance+delta < 0 {
+		log.Warn("insufficient funds, balance: %v, amount: %v", user.Balance, -delta)
+		return models.ErrInsufficientFunds
+	}
+
+	return nil
+}
+
+// transactionType CREDIT or DEBIT by the sign of delta
+func transactionType(delta float64) string {
+	if delta < 0 {
+		return "DEBIT"
+	}
+
+	return "CREDIT"
+}
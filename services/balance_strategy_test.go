@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"wyvern-api/models"
+	"wyvern-api/repositories"
+)
+
+const (
+	findUserSQL            = "SELECT \\* FROM `users` WHERE `users`.`id` = \\? ORDER BY `users`.`id` LIMIT \\?$"
+	addBalanceIfVersionSQL = "UPDATE `users` SET `balance`=balance \\+ \\?,`version`=version \\+ 1 WHERE id = \\? AND version = \\?"
+)
+
+func versionedUserRows(balance float64, version int64) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "username", "balance", "status", "version"}).AddRow(1, "Fulan", balance, models.UserStatusActive, version)
+}
+
+func TestOptimisticStrategy(t *testing.T) {
+	t.Run("version conflict re-runs the transaction with a fresh read", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(findUserSQL).WillReturnRows(versionedUserRows(500, 7))
+		mock.ExpectExec(addBalanceIfVersionSQL).WithArgs(float64(100), 1, 7).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectQuery(findUserSQL).WillReturnRows(versionedUserRows(800, 8))
+		mock.ExpectExec(addBalanceIfVersionSQL).WithArgs(float64(100), 1, 8).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(insertTransaction).WillReturnResult(sqlmock.NewResult(12, 1))
+		mock.ExpectCommit()
+
+		runner := &GormTxRunner{db: db, retry: RetryPolicy{MaxAttempts: 3}}
+		svc := NewTransactionService(testConfig(), repositories.NewTransactionRepo(db), NewOptimisticStrategy(repositories.NewUserRepo(db)), runner, nil, db, nil)
+		resp, err := svc.Credit(context.Background(), models.CreditRequest{UserID: 1, Amount: 100})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if resp.TransactionID != 12 || resp.NewBalance != 900 {
+			t.Errorf("expected transaction 12 with balance 900, got %+v", resp)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("conflict after max attempts", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(findUserSQL).WillReturnRows(versionedUserRows(500, 7))
+		mock.ExpectExec(addBalanceIfVersionSQL).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		runner := &GormTxRunner{db: db, retry: RetryPolicy{MaxAttempts: 1}}
+		svc := NewTransactionService(testConfig(), repositories.NewTransactionRepo(db), NewOptimisticStrategy(repositories.NewUserRepo(db)), runner, nil, db, nil)
+		_, err := svc.Debit(context.Background(), models.DebitRequest{UserID: 1, Amount: 100})
+		if !errors.Is(err, models.ErrVersionConflict) {
+			t.Fatalf("expected %s, got %v", models.ErrVersionConflict.Code, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("insufficient funds does not touch the row", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(findUserSQL).WillReturnRows(versionedUserRows(50, 7))
+		mock.ExpectRollback()
+
+		svc := NewTransactionService(testConfig(), repositories.NewTransactionRepo(db), NewOptimisticStrategy(repositories.NewUserRepo(db)), NewGormTxRunner(testConfig(), db), nil, db, nil)
+		_, err := svc.Debit(context.Background(), models.DebitRequest{UserID: 1, Amount: 100})
+		if !errors.Is(err, models.ErrInsufficientFunds) {
+			t.Fatalf("expected %s, got %v", models.ErrInsufficientFunds.Code, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestNewBalanceStrategy(t *testing.T) {
+	for _, name := range []string{"", BalanceStrategyPessimistic, BalanceStrategyOptimistic} {
+		if _, err := NewBalanceStrategy(name, nil, 0); err != nil {
+			t.Errorf("expected strategy %q, got %v", name, err)
+		}
+	}
+	if _, err := NewBalanceStrategy("magic", nil, 0); err == nil {
+		t.Error("expected unknown strategy to fail")
+	}
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+	"wyvern-api/models"
+)
+
+// contextDB session bound to ctx. SQL spans are children of the span in ctx, and when ctx is canceled or past
+// its deadline the running statement is aborted and an open transaction is rolled back by database/sql.
+func contextDB(db *gorm.DB, ctx context.Context) *gorm.DB {
+	return db.WithContext(ctx)
+}
+
+// withTimeout ctx bounded by timeout, zero timeout only adds a cancel
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// dbError map failed statement to ErrTimeout or ErrRequestCanceled when ctx ended, to ErrLockConflict on
+// deadlock or lock wait timeout, otherwise wrap it in fallback
+func dbError(ctx context.Context, err error, fallback *models.AppError) error {
+	switch {
+	case isRetryable(err):
+		return models.ErrLockConflict.Wrap(err)
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return models.ErrTimeout.Wrap(err)
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		return models.ErrRequestCanceled.Wrap(err)
+	}
+
+	return fallback.Wrap(err)
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"wyvern-api/models"
+)
+
+func TestDBError(t *testing.T) {
+	expired, cancelExpired := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancelExpired()
+	<-expired.Done()
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want *models.AppError
+	}{
+		{"deadline error", context.Background(), context.DeadlineExceeded, models.ErrTimeout},
+		{"ctx past deadline", expired, errors.New("driver: bad connection"), models.ErrTimeout},
+		{"ctx canceled", canceled, errors.New("driver: bad connection"), models.ErrRequestCanceled},
+		{"other error", context.Background(), errors.New("duplicate key"), models.ErrTransactionNotCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dbError(tt.ctx, tt.err, models.ErrTransactionNotCreated)
+			if !errors.Is(got, tt.want) {
+				t.Errorf("expected %s, got %v", tt.want.Code, got)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("expected cause %v to be kept", tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wyvern-api/config"
+	"wyvern-api/models"
+)
+
+// HealthChecker interface, a dependency that must be healthy for the service to be ready
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// SchemaProcessor interface, implemented by migrations.Migrator
+type SchemaProcessor interface {
+	Check(ctx context.Context) error
+}
+
+// HealthService struct, lives for the whole process
+type HealthService struct {
+	db        *gorm.DB
+	mu        sync.RWMutex
+	checks    []HealthChecker
+	startedAt time.Time
+	draining  atomic.Bool
+}
+
+// NewHealthService initiate HealthService, database is always checked, within dbTimeout
+func NewHealthService(db *gorm.DB, dbTimeout time.Duration, checks ...HealthChecker) *HealthService {
+	return &HealthService{
+		db:        db,
+		checks:    append([]HealthChecker{NewDBChecker(db, dbTimeout)}, checks...),
+		startedAt: time.Now(),
+	}
+}
+
+// AddCheck is method to add readiness check
+func (svc *HealthService) AddCheck(check HealthChecker) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.checks = append(svc.checks, check)
+}
+
+// SetDraining is method to fail readiness, so the orchestrator stops sending traffic before shutdown
+func (svc *HealthService) SetDraining() {
+	svc.draining.Store(true)
+}
+
+// Draining is method to check whether the process is shutting down
+func (svc *HealthService) Draining() bool {
+	return svc.draining.Load()
+}
+
+// Readiness is method to run every check, it returns false when any check fails or the process is draining
+func (svc *HealthService) Readiness(ctx context.Context) (models.HealthReport, bool) {
+	svc.mu.RLock()
+	checks := svc.checks
+	svc.mu.RUnlock()
+
+	report := models.HealthReport{
+		Status: models.HealthStatusOK,
+		Checks: make(map[string]models.HealthCheckResult, len(checks)),
+	}
+
+	for _, check := range checks {
+		start := time.Now()
+		result := models.HealthCheckResult{Status: models.HealthStatusOK}
+		if err := check.Check(ctx); err != nil {
+			result.Status = models.HealthStatusFailing
+			result.Error = err.Error()
+			report.Status = models.HealthStatusFailing
+		}
+		result.Duration = time.Since(start).String()
+		report.Checks[check.Name()] = result
+	}
+
+	if svc.Draining() {
+		report.Status = models.HealthStatusDraining
+	}
+
+	return report, report.Status == models.HealthStatusOK
+}
+
+// Status is method to build detailed status for operators
+func (svc *HealthService) Status(ctx context.Context) models.StatusReport {
+	readiness, _ := svc.Readiness(ctx)
+
+	report := models.StatusReport{
+		Version:           config.Version,
+		GoVersion:         runtime.Version(),
+		StartedAt:         svc.startedAt,
+		Uptime:            time.Since(svc.startedAt).Round(time.Second).String(),
+		Draining:          svc.Draining(),
+		ConfigFingerprint: config.Fingerprint(),
+		Readiness:         readiness,
+	}
+
+	if sqlDB, err := svc.db.DB(); err == nil {
+		stats := sqlDB.Stats()
+		report.DBPool = models.DBPoolStats{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDuration:       stats.WaitDuration.String(),
+			MaxIdleClosed:      stats.MaxIdleClosed,
+			MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		}
+	}
+
+	return report
+}
+
+// DBChecker struct ping database with timeout
+type DBChecker struct {
+	db      *gorm.DB
+	timeout time.Duration
+}
+
+// NewDBChecker initiate DBChecker
+func NewDBChecker(db *gorm.DB, timeout time.Duration) *DBChecker {
+	return &DBChecker{
+		db:      db,
+		timeout: timeout,
+	}
+}
+
+// Name implement HealthChecker
+func (c *DBChecker) Name() string {
+	return "database"
+}
+
+// Check implement HealthChecker
+func (c *DBChecker) Check(ctx context.Context) error {
+	sqlDB, err := c.db.DB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return sqlDB.PingContext(ctx)
+}
+
+// MigrationChecker struct fail while a migration of this build is pending, e.g. after "migrate down" on a running
+// replica, so it stops taking traffic it can not serve
+type MigrationChecker struct {
+	schema  SchemaProcessor
+	timeout time.Duration
+}
+
+// NewMigrationChecker initiate MigrationChecker
+func NewMigrationChecker(schema SchemaProcessor, timeout time.Duration) *MigrationChecker {
+	return &MigrationChecker{
+		schema:  schema,
+		timeout: timeout,
+	}
+}
+
+// Name implement HealthChecker
+func (c *MigrationChecker) Name() string {
+	return "migrations"
+}
+
+// Check implement HealthChecker
+func (c *MigrationChecker) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.schema.Check(ctx)
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"sort"
+	"sync/atomic"
+	"time"
+	"wyvern-api/dialects"
+	"wyvern-api/metrics"
+	"wyvern-api/utils"
+)
+
+// ReplicaRouter route reads that may be slightly stale to a read replica, everything else stays on the primary.
+// A replica is used only while its last measured lag is within maxLag; before the first check, or when no
+// replica is fresh, reads go to the primary.
+type ReplicaRouter struct {
+	primary  *gorm.DB
+	replicas []*replica
+	maxLag   time.Duration
+	// checkTimeout deadline of one lag check
+	checkTimeout time.Duration
+	next         atomic.Uint64
+}
+
+// replica one read replica and whether its last lag check passed
+type replica struct {
+	name  string
+	db    *gorm.DB
+	fresh atomic.Bool
+}
+
+// NewReplicaRouter initiate ReplicaRouter over replicas by name, call Start to check their lag, each check
+// within checkTimeout
+func NewReplicaRouter(primary *gorm.DB, replicas map[string]*gorm.DB, maxLag time.Duration, checkTimeout time.Duration) *ReplicaRouter {
+	r := &ReplicaRouter{
+		primary:      primary,
+		maxLag:       maxLag,
+		checkTimeout: checkTimeout,
+	}
+	for name, db := range replicas {
+		r.replicas = append(r.replicas, &replica{name: name, db: db})
+	}
+	sort.Slice(r.replicas, func(i, j int) bool { return r.replicas[i].name < r.replicas[j].name })
+
+	return r
+}
+
+// Reader is method to pick a fresh replica round robin, or the primary when there is none
+func (r *ReplicaRouter) Reader() *gorm.DB {
+	for range r.replicas {
+		candidate := r.replicas[r.next.Add(1)%uint64(len(r.replicas))]
+		if candidate.fresh.Load() {
+			return candidate.db
+		}
+	}
+
+	return r.primary
+}
+
+// Check is method to measure the lag of every replica and mark which ones may serve reads
+func (r *ReplicaRouter) Check(ctx context.Context) {
+	for _, replica := range r.replicas {
+		log := utils.NewLoggerFromContext(ctx, "ReplicaRouter", 0).Service().AddField("replica", replica.name)
+
+		checkCtx, cancel := withTimeout(ctx, r.checkTimeout)
+		lag, err := dialects.For(replica.db).ReplicationLag(contextDB(replica.db, checkCtx))
+		cancel()
+
+		fresh := err == nil && lag <= r.maxLag
+		if err != nil {
+			lag = -1
+			log.Warn("failed measure replication lag, error: %s", err.Error())
+		} else if !fresh {
+			log.Warn("replication lag %s above %s", lag, r.maxLag)
+		}
+		if was := replica.fresh.Swap(fresh); was != fresh {
+			log.Info("replica fresh: %t", fresh)
+		}
+		metrics.ObserveReplicaLag(replica.name, lag)
+	}
+}
+
+// Start is method to check the lag of the replicas now and every interval until workers stop
+func (r *ReplicaRouter) Start(workers *utils.Workers, interval time.Duration) {
+	if len(r.replicas) == 0 {
+		return
+	}
+
+	r.Check(context.Background())
+	workers.Go("ReplicaRouter", func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.Check(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+const replicaStatusSQL = "SHOW REPLICA STATUS"
+
+func replicaStatusRows(lag any) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"Source_Host", "Seconds_Behind_Source"}).AddRow("primary", lag)
+}
+
+func TestReplicaRouter(t *testing.T) {
+	t.Run("reads go to the primary before the first check", func(t *testing.T) {
+		primary, _ := newSQLMock(t)
+		replica, _ := newSQLMock(t)
+		router := NewReplicaRouter(primary, map[string]*gorm.DB{"replica-1": replica}, time.Second, time.Second)
+
+		if router.Reader() != primary {
+			t.Error("expected primary")
+		}
+	})
+
+	t.Run("reads go to replicas within max lag round robin", func(t *testing.T) {
+		primary, _ := newSQLMock(t)
+		first, firstMock := newSQLMock(t)
+		second, secondMock := newSQLMock(t)
+		firstMock.ExpectQuery(replicaStatusSQL).WillReturnRows(replicaStatusRows(0))
+		secondMock.ExpectQuery(replicaStatusSQL).WillReturnRows(replicaStatusRows(1))
+
+		router := NewReplicaRouter(primary, map[string]*gorm.DB{"replica-1": first, "replica-2": second}, time.Second, time.Second)
+		router.Check(context.Background())
+
+		seen := map[*gorm.DB]int{}
+		for i := 0; i < 4; i++ {
+			seen[router.Reader()]++
+		}
+		if seen[first] != 2 || seen[second] != 2 {
+			t.Errorf("expected reads spread over both replicas, got %d and %d", seen[first], seen[second])
+		}
+		if err := firstMock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		if err := secondMock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("lagging or stopped replicas fall back to the primary", func(t *testing.T) {
+		primary, _ := newSQLMock(t)
+		lagging, laggingMock := newSQLMock(t)
+		stopped, stoppedMock := newSQLMock(t)
+		laggingMock.ExpectQuery(replicaStatusSQL).WillReturnRows(replicaStatusRows(0))
+		laggingMock.ExpectQuery(replicaStatusSQL).WillReturnRows(replicaStatusRows(5))
+		stoppedMock.ExpectQuery(replicaStatusSQL).WillReturnRows(replicaStatusRows(0))
+		stoppedMock.ExpectQuery(replicaStatusSQL).WillReturnRows(replicaStatusRows(nil))
+
+		router := NewReplicaRouter(primary, map[string]*gorm.DB{"lagging": lagging, "stopped": stopped}, time.Second, time.Second)
+		router.Check(context.Background())
+		if router.Reader() == primary {
+			t.Fatal("expected a replica while both are fresh")
+		}
+
+		router.Check(context.Background())
+		if router.Reader() != primary {
+			t.Error("expected primary")
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+	"wyvern-api/dialects"
+	"wyvern-api/models"
+)
+
+// RetryPolicy how often and how fast a unit of work is re-run after a retryable error
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// backoff delay before re-running attempt, doubling from BaseDelay up to MaxDelay with half of it jittered,
+// so transactions that deadlocked each other do not collide again
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// retryReason snake_case reason when err is retryable, empty otherwise
+func retryReason(err error) string {
+	if errors.Is(err, models.ErrVersionConflict) {
+		return "version_conflict"
+	}
+
+	// after these the database rolled back the statement or the whole transaction, re-running it is safe
+	switch dialects.Classify(err) {
+	case dialects.ErrorDeadlock:
+		return "deadlock"
+	case dialects.ErrorLockWaitTimeout:
+		return "lock_wait_timeout"
+	}
+
+	return ""
+}
+
+// isRetryable check whether a unit of work failed with err can be re-run from the start
+func isRetryable(err error) bool {
+	return retryReason(err) != ""
+}
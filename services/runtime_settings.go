@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"maps"
+	"os"
+	"time"
+	"wyvern-api/config"
+	"wyvern-api/utils"
+)
+
+// RuntimeSettingProcessor interface
+type RuntimeSettingProcessor interface {
+	All(ctx context.Context, db *gorm.DB) (map[string]string, error)
+}
+
+// RuntimeSettings reload the config when its env files, or the runtime_settings table, change.
+// config.Reload validates the new config and swaps it in only when nothing but reloadable values changed.
+type RuntimeSettings struct {
+	sp           RuntimeSettingProcessor
+	db           *gorm.DB
+	queryTimeout time.Duration
+
+	// what the last check saw, a reload is only tried when it differs
+	files  map[string]fileStamp
+	values map[string]string
+}
+
+// fileStamp what tells a changed file apart, the zero value for a missing file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewRuntimeSettings initiate RuntimeSettings, sp and db are nil without the runtime_settings table,
+// reading it takes at most queryTimeout
+func NewRuntimeSettings(sp RuntimeSettingProcessor, db *gorm.DB, queryTimeout time.Duration) *RuntimeSettings {
+	return &RuntimeSettings{
+		sp:           sp,
+		db:           db,
+		queryTimeout: queryTimeout,
+	}
+}
+
+// Check is method to reload the config when a file or the table changed since the last check, it returns
+// what changed. A rejected reload is logged once, the next one is tried on the next change.
+func (s *RuntimeSettings) Check(ctx context.Context) ([]config.Change, error) {
+	log := utils.NewLoggerFromContext(ctx, "RuntimeSettings", 0).Service()
+
+	files := map[string]fileStamp{}
+	for _, file := range config.Files() {
+		if info, err := os.Stat(file); err == nil {
+			files[file] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+
+	var values map[string]string
+	if s.sp != nil {
+		queryCtx, cancel := withTimeout(ctx, s.queryTimeout)
+		var err error
+		values, err = s.sp.All(queryCtx, contextDB(s.db, queryCtx))
+		cancel()
+		if err != nil {
+			log.Warn("failed read runtime settings, error: %s", err.Error())
+			return nil, err
+		}
+	}
+
+	if s.files != nil && maps.Equal(files, s.files) && maps.Equal(values, s.values) {
+		return nil, nil
+	}
+	s.files, s.values = files, values
+
+	changes, err := config.Reload(values)
+	if err != nil {
+		log.Error("%s", err.Error())
+		return nil, err
+	}
+	for _, change := range changes {
+		log.Info("config %s changed from %q to %q", change.Key, change.Old, change.New)
+	}
+
+	return changes, nil
+}
+
+// Start is method to check for changes now and every interval until workers stop
+func (s *RuntimeSettings) Start(workers *utils.Workers, interval time.Duration) {
+	log := utils.NewLogger("RuntimeSettings", 0)
+	log.Info("watching %v every %s, runtime_settings table: %t", config.Files(), interval, s.sp != nil)
+
+	_, _ = s.Check(context.Background())
+	workers.Go("RuntimeSettings", func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				_, _ = s.Check(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+	"wyvern-api/config"
+	"wyvern-api/models"
+	"wyvern-api/utils"
+)
+
+// ShardService struct, reshard and rebalance the balance shards of users
+type ShardService struct {
+	cfg    *config.Config
+	up     ShardedUserProcessor
+	bp     BalanceShardProcessor
+	runner TxRunner
+	db     *gorm.DB
+	units  amountUnits
+}
+
+// NewShardService initiate ShardService
+func NewShardService(cfg *config.Config, up ShardedUserProcessor, bp BalanceShardProcessor, runner TxRunner, db *gorm.DB) *ShardService {
+	return &ShardService{
+		cfg:    cfg,
+		up:     up,
+		bp:     bp,
+		runner: runner,
+		db:     db,
+		units:  amountUnits(cfg.TransactionAmountPrecision),
+	}
+}
+
+// SetShardCount is method to spread the balance of user over shardCount shards, 0 moves it back to users.balance.
+// The user row is locked for update, so changes in flight finish first and later ones wait for the new layout.
+// Without BALANCE_SHARDING_ENABLED only 0 is accepted, the balance strategy would not read the shards.
+func (svc *ShardService) SetShardCount(ctx context.Context, userID int64, shardCount int) (balance float64, err error) {
+	log := utils.NewLoggerFromContext(ctx, "SetShardCount", 1).Service().AddField("user_id", userID)
+	log.Info("shard count: %d", shardCount)
+
+	if shardCount < 0 || shardCount > svc.cfg.BalanceShardMax {
+		return 0, fmt.Errorf("shard count must be between 0 and %d", svc.cfg.BalanceShardMax)
+	}
+	if shardCount > 0 && !svc.cfg.BalanceShardingEnabled {
+		return 0, errors.New("balance sharding is disabled, set BALANCE_SHARDING_ENABLED=true first")
+	}
+
+	ctx, cancel := withTimeout(ctx, svc.cfg.DbTransactionTimeout)
+	defer cancel()
+
+	err = svc.runner.Run(ctx, func(tx *gorm.DB) error {
+		user, err := svc.up.LockByID(ctx, tx, userID)
+		if err != nil {
+			return findUserError(ctx, log, userID, err)
+		}
+		shards, err := svc.bp.LockAll(ctx, tx, userID)
+		if err != nil {
+			log.Warn("failed lock shards, error: %s", err.Error())
+			return dbError(ctx, err, models.ErrDatabase)
+		}
+
+		total := svc.units.toUnits(user.Balance)
+		for _, shard := range shards {
+			total += svc.units.toUnits(shard.Balance)
+		}
+		balance = svc.units.fromUnits(total)
+
+		userBalance, next := balance, []models.BalanceShard(nil)
+		if shardCount > 0 {
+			userBalance, next = 0, svc.units.splitBalance(userID, balance, shardCount)
+		}
+		if err := svc.bp.Replace(ctx, tx, userID, next); err != nil {
+			log.Warn("failed replace shards, error: %s", err.Error())
+			return dbError(ctx, err, models.ErrDatabase)
+		}
+		if err := svc.up.SetShardCount(ctx, tx, userID, shardCount, userBalance); err != nil {
+			log.Warn("failed update user, error: %s", err.Error())
+			return dbError(ctx, err, models.ErrDatabase)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	log.Info("user %d balance %v spread over %d shards", userID, balance, shardCount)
+	return balance, nil
+}
+
+// Rebalance is method to even out the shards of user, so a debit needs to lock as few of them as possible.
+// Shards held by credits/debits in flight are skipped, the others are evened out among themselves.
+func (svc *ShardService) Rebalance(ctx context.Context, userID int64) error {
+	log := utils.NewLoggerFromContext(ctx, "Rebalance", 1).Service().AddField("user_id", userID)
+
+	ctx, cancel := withTimeout(ctx, svc.cfg.DbTransactionTimeout)
+	defer cancel()
+
+	return svc.runner.Run(ctx, func(tx *gorm.DB) error {
+		// keep a reshard out while the shards are rewritten
+		if _, err := svc.up.ShareLockByID(ctx, tx, userID); err != nil {
+			return findUserError(ctx, log, userID, err)
+		}
+		shards, err := svc.bp.LockAvailable(ctx, tx, userID)
+		if err != nil {
+			log.Warn("failed lock shards, error: %s", err.Error())
+			return dbError(ctx, err, models.ErrDatabase)
+		}
+		if len(shards) < 2 {
+			return nil
+		}
+
+		var total int64
+		for _, shard := range shards {
+			total += svc.units.toUnits(shard.Balance)
+		}
+		for i, even := range svc.units.splitBalance(userID, svc.units.fromUnits(total), len(shards)) {
+			if svc.units.toUnits(shards[i].Balance) == svc.units.toUnits(even.Balance) {
+				continue
+			}
+			if err := svc.bp.SetBalance(ctx, tx, userID, shards[i].ShardNo, even.Balance); err != nil {
+				log.Warn("failed update shard %d, error: %s", shards[i].ShardNo, err.Error())
+				return dbError(ctx, err, models.ErrDatabase)
+			}
+		}
+		return nil
+	})
+}
+
+// RebalanceAll is method to rebalance every sharded user, one transaction each
+func (svc *ShardService) RebalanceAll(ctx context.Context) error {
+	log := utils.NewLoggerFromContext(ctx, "RebalanceAll", 1).Service()
+
+	queryCtx, cancel := withTimeout(ctx, svc.cfg.DbQueryTimeout)
+	IDs, err := svc.bp.ShardedUserIDs(queryCtx, contextDB(svc.db, queryCtx))
+	cancel()
+	if err != nil {
+		log.Warn("failed list sharded users, error: %s", err.Error())
+		return dbError(ctx, err, models.ErrDatabase)
+	}
+
+	var failed error
+	for _, userID := range IDs {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := svc.Rebalance(ctx, userID); err != nil {
+			failed = errors.Join(failed, fmt.Errorf("user %d: %w", userID, err))
+		}
+	}
+
+	return failed
+}
+
+// StartRebalancer is method to rebalance every sharded user each interval until workers stop
+func (svc *ShardService) StartRebalancer(workers *utils.Workers, interval time.Duration) {
+	workers.Go("ShardRebalancer", func(ctx context.Context) {
+		log := utils.NewLoggerFromContext(ctx, "ShardRebalancer", 0).Service()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := svc.RebalanceAll(ctx); err != nil {
+					log.Warn("failed rebalance shards, error: %s", err.Error())
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"math"
+	"math/rand"
+	"wyvern-api/models"
+	"wyvern-api/utils"
+)
+
+// ShardedUserProcessor interface, UserProcessor able to share lock a user and move its balance between users.balance and shards
+type ShardedUserProcessor interface {
+	UserProcessor
+	ShareLockByID(ctx context.Context, db *gorm.DB, ID int64) (models.User, error)
+	SetShardCount(ctx context.Context, db *gorm.DB, ID int64, shardCount int, balance float64) error
+}
+
+// BalanceShardProcessor interface
+type BalanceShardProcessor interface {
+	AddBalance(ctx context.Context, db *gorm.DB, userID int64, shardNo int, amount float64) (bool, error)
+	LockByNo(ctx context.Context, db *gorm.DB, userID int64, shardNo int) (models.BalanceShard, error)
+	LockAll(ctx context.Context, db *gorm.DB, userID int64) ([]models.BalanceShard, error)
+	LockAvailable(ctx context.Context, db *gorm.DB, userID int64) ([]models.BalanceShard, error)
+	Sum(ctx context.Context, db *gorm.DB, userID int64) (float64, error)
+	Replace(ctx context.Context, db *gorm.DB, userID int64, shards []models.BalanceShard) error
+	SetBalance(ctx context.Context, db *gorm.DB, userID int64, shardNo int, balance float64) error
+	ShardedUserIDs(ctx context.Context, db *gorm.DB) ([]int64, error)
+}
+
+// ShardedStrategy spread the balance of a user with shard_count > 0 over balance_shards rows, so concurrent
+// changes of one hot account lock different rows. Other users go through base.
+//
+// A sharded change holds a shared lock on the user row: changes do not wait for each other on it,
+// only a reshard, which locks it for update, does.
+type ShardedStrategy struct {
+	base  BalanceStrategy
+	up    ShardedUserProcessor
+	bp    BalanceShardProcessor
+	units amountUnits
+}
+
+// NewShardedStrategy initiate ShardedStrategy, shards are split in amounts of precision decimal places
+func NewShardedStrategy(base BalanceStrategy, up ShardedUserProcessor, bp BalanceShardProcessor, precision int) *ShardedStrategy {
+	return &ShardedStrategy{
+		base:  base,
+		up:    up,
+		bp:    bp,
+		units: amountUnits(precision),
+	}
+}
+
+// Apply implement BalanceStrategy
+func (s *ShardedStrategy) Apply(ctx context.Context, tx *gorm.DB, userID int64, delta float64) (models.User, error) {
+	log := utils.NewLoggerFromContext(ctx, "ShardedStrategy", 1).Service().AddField("user_id", userID)
+
+	// plain read, most users are not sharded and must not pay for a second lock
+	user, err := s.up.FindByID(ctx, tx, userID)
+	if err != nil {
+		return user, findUserError(ctx, log, userID, err)
+	}
+	if user.ShardCount == 0 {
+		user, err = s.base.Apply(ctx, tx, userID, delta)
+		if err == nil && user.ShardCount != 0 {
+			// sharded since the read, the change went to users.balance which no longer holds the balance
+			log.Warn("user %d sharded while changing its balance", userID)
+			return user, models.ErrVersionConflict
+		}
+		return user, err
+	}
+
+	user, err = s.up.ShareLockByID(ctx, tx, userID)
+	if err != nil {
+		return user, findUserError(ctx, log, userID, err)
+	}
+	if user.ShardCount == 0 {
+		log.Warn("user %d unsharded while changing its balance", userID)
+		return user, models.ErrVersionConflict
+	}
+	if err := checkBalanceChange(log, user, 0); err != nil {
+		return user, err
+	}
+
+	if delta >= 0 {
+		err = s.credit(ctx, tx, log, user, delta)
+	} else {
+		err = s.debit(ctx, tx, log, user, -delta)
+	}
+	if err != nil {
+		return user, err
+	}
+
+	balance, err := s.bp.Sum(ctx, tx, userID)
+	if err != nil {
+		log.Warn("failed sum shards, error: %s", err.Error())
+		return user, dbError(ctx, err, models.ErrDatabase)
+	}
+
+	user.Balance = balance
+	return user, nil
+}
+
+// credit is method to add amount to one random shard of user
+func (s *ShardedStrategy) credit(ctx context.Context, tx *gorm.DB, log *utils.Logger, user models.User, amount float64) error {
+	shardNo := rand.Intn(user.ShardCount)
+	applied, err := s.bp.AddBalance(ctx, tx, user.ID, shardNo, amount)
+	if err != nil {
+		log.Warn("failed update shard %d, error: %s", shardNo, err.Error())
+		return dbError(ctx, err, models.ErrDatabase)
+	}
+	if !applied {
+		log.Warn("shard %d of user %d missing", shardNo, user.ID)
+		return models.ErrVersionConflict
+	}
+
+	return nil
+}
+
+// debit is method to lock shards of user in shard_no order until they cover amount, then take it from them
+func (s *ShardedStrategy) debit(ctx context.Context, tx *gorm.DB, log *utils.Logger, user models.User, amount float64) error {
+	need := s.units.toUnits(amount)
+
+	var locked []models.BalanceShard
+	var covered int64
+	for shardNo := 0; shardNo < user.ShardCount && covered < need; shardNo++ {
+		shard, err := s.bp.LockByNo(ctx, tx, user.ID, shardNo)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("shard %d of user %d missing", shardNo, user.ID)
+			return models.ErrVersionConflict
+		}
+		if err != nil {
+			log.Warn("failed lock shard %d, error: %s", shardNo, err.Error())
+			return dbError(ctx, err, models.ErrDatabase)
+		}
+		if units := s.units.toUnits(shard.Balance); units > 0 {
+			locked = append(locked, shard)
+			covered += units
+		}
+	}
+	if covered < need {
+		log.Warn("insufficient funds, balance: %v, amount: %v", s.units.fromUnits(covered), amount)
+		return models.ErrInsufficientFunds
+	}
+
+	for _, shard := range locked {
+		take := min(s.units.toUnits(shard.Balance), need)
+		if _, err := s.bp.AddBalance(ctx, tx, user.ID, shard.ShardNo, -s.units.fromUnits(take)); err != nil {
+			log.Warn("failed update shard %d, error: %s", shard.ShardNo, err.Error())
+			return dbError(ctx, err, models.ErrDatabase)
+		}
+		need -= take
+	}
+
+	return nil
+}
+
+// splitBalance total spread evenly over n shards, the units left over go one each to the first shards
+func (u amountUnits) splitBalance(userID int64, total float64, n int) []models.BalanceShard {
+	units := u.toUnits(total)
+	each, rest := units/int64(n), units%int64(n)
+
+	shards := make([]models.BalanceShard, n)
+	for i := range shards {
+		share := each
+		if int64(i) < rest {
+			share++
+		}
+		shards[i] = models.BalanceShard{UserID: userID, ShardNo: i, Balance: u.fromUnits(share)}
+	}
+
+	return shards
+}
+
+// amountUnits decimal places of TRANSACTION_AMOUNT_PRECISION, amounts are added up in its smallest unit
+type amountUnits int
+
+// toUnits amount in the smallest unit, so shards add up without float drift
+func (u amountUnits) toUnits(amount float64) int64 {
+	return int64(math.Round(amount * math.Pow10(int(u))))
+}
+
+// fromUnits inverse of toUnits
+func (u amountUnits) fromUnits(units int64) float64 {
+	return float64(units) / math.Pow10(int(u))
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/gorm"
+	"testing"
+	"wyvern-api/models"
+	"wyvern-api/repositories"
+)
+
+const (
+	shareLockUserSQL = "SELECT \\* FROM `users` WHERE `users`.`id` = \\? .*FOR SHARE"
+	addShardSQL      = "UPDATE `balance_shards` SET `balance`=balance \\+ \\? WHERE user_id = \\? AND shard_no = \\?"
+	lockShardSQL     = "SELECT \\* FROM `balance_shards` WHERE user_id = \\? AND shard_no = \\? LIMIT \\? FOR UPDATE"
+	lockShardsSQL    = "SELECT \\* FROM `balance_shards` WHERE user_id = \\? ORDER BY shard_no FOR UPDATE"
+	sumShardsSQL     = "SELECT COALESCE\\(SUM\\(balance\\), 0\\) FROM `balance_shards`"
+)
+
+func shardedUserRows(shardCount int) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "username", "balance", "status", "shard_count"}).AddRow(1, "Fulan", 0, models.UserStatusActive, shardCount)
+}
+
+func shardRows(shardNo int, balance float64) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"user_id", "shard_no", "balance"}).AddRow(1, shardNo, balance)
+}
+
+func newShardedStrategy(db *gorm.DB) *ShardedStrategy {
+	up := repositories.NewUserRepo(db)
+	return NewShardedStrategy(NewPessimisticStrategy(up, 0), up, repositories.NewBalanceShardRepo(db), 2)
+}
+
+func TestShardedStrategy(t *testing.T) {
+	t.Run("unsharded user goes through base", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(findUserSQL).WillReturnRows(userRows(500, models.UserStatusActive))
+		mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(500, models.UserStatusActive))
+		mock.ExpectExec(addBalanceSQL).WithArgs(float64(100), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		var user models.User
+		err := NewGormTxRunner(testConfig(), db).Run(context.Background(), func(tx *gorm.DB) (err error) {
+			user, err = newShardedStrategy(db).Apply(context.Background(), tx, 1, 100)
+			return err
+		})
+		if err != nil || user.Balance != 600 {
+			t.Errorf("expected balance 600, got %v, %v", user.Balance, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("credit goes to one shard", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(findUserSQL).WillReturnRows(shardedUserRows(1))
+		mock.ExpectQuery(shareLockUserSQL).WillReturnRows(shardedUserRows(1))
+		mock.ExpectExec(addShardSQL).WithArgs(float64(100), 1, 0).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(sumShardsSQL).WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(700))
+		mock.ExpectCommit()
+
+		var user models.User
+		err := NewGormTxRunner(testConfig(), db).Run(context.Background(), func(tx *gorm.DB) (err error) {
+			user, err = newShardedStrategy(db).Apply(context.Background(), tx, 1, 100)
+			return err
+		})
+		if err != nil || user.Balance != 700 {
+			t.Errorf("expected balance 700, got %v, %v", user.Balance, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("debit locks only the shards covering it", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(findUserSQL).WillReturnRows(shardedUserRows(4))
+		mock.ExpectQuery(shareLockUserSQL).WillReturnRows(shardedUserRows(4))
+		mock.ExpectQuery(lockShardSQL).WithArgs(1, 0, 1).WillReturnRows(shardRows(0, 30.25))
+		mock.ExpectQuery(lockShardSQL).WithArgs(1, 1, 1).WillReturnRows(shardRows(1, 50))
+		mock.ExpectExec(addShardSQL).WithArgs(-30.25, 1, 0).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(addShardSQL).WithArgs(-29.75, 1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(sumShardsSQL).WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(120.25))
+		mock.ExpectCommit()
+
+		var user models.User
+		err := NewGormTxRunner(testConfig(), db).Run(context.Background(), func(tx *gorm.DB) (err error) {
+			user, err = newShardedStrategy(db).Apply(context.Background(), tx, 1, -60)
+			return err
+		})
+		if err != nil || user.Balance != 120.25 {
+			t.Errorf("expected balance 120.25, got %v, %v", user.Balance, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("debit over every shard is refused before writing", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(findUserSQL).WillReturnRows(shardedUserRows(2))
+		mock.ExpectQuery(shareLockUserSQL).WillReturnRows(shardedUserRows(2))
+		mock.ExpectQuery(lockShardSQL).WillReturnRows(shardRows(0, 10))
+		mock.ExpectQuery(lockShardSQL).WillReturnRows(shardRows(1, 10))
+		mock.ExpectRollback()
+
+		err := NewGormTxRunner(testConfig(), db).Run(context.Background(), func(tx *gorm.DB) error {
+			_, err := newShardedStrategy(db).Apply(context.Background(), tx, 1, -60)
+			return err
+		})
+		if !errors.Is(err, models.ErrInsufficientFunds) {
+			t.Errorf("expected %s, got %v", models.ErrInsufficientFunds.Code, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("resharded while applying conflicts", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(findUserSQL).WillReturnRows(shardedUserRows(2))
+		mock.ExpectQuery(shareLockUserSQL).WillReturnRows(shardedUserRows(0))
+		mock.ExpectRollback()
+
+		runner := &GormTxRunner{db: db, retry: RetryPolicy{MaxAttempts: 1}}
+		err := runner.Run(context.Background(), func(tx *gorm.DB) error {
+			_, err := newShardedStrategy(db).Apply(context.Background(), tx, 1, 100)
+			return err
+		})
+		if !errors.Is(err, models.ErrVersionConflict) {
+			t.Errorf("expected %s, got %v", models.ErrVersionConflict.Code, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestSplitBalance(t *testing.T) {
+	shards := amountUnits(2).splitBalance(1, 100.01, 3)
+	expected := []float64{33.34, 33.34, 33.33}
+	for i, shard := range shards {
+		if shard.ShardNo != i || shard.Balance != expected[i] {
+			t.Errorf("expected shard %d with %v, got %+v", i, expected[i], shard)
+		}
+	}
+}
+
+func TestShardService_SetShardCount(t *testing.T) {
+	db, mock := newSQLMock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(100, models.UserStatusActive))
+	mock.ExpectQuery(lockShardsSQL).WillReturnRows(sqlmock.NewRows([]string{"user_id", "shard_no", "balance"}))
+	mock.ExpectExec("DELETE FROM `balance_shards` WHERE user_id = \\?").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO `balance_shards`").WithArgs(1, 0, float64(50), 1, 1, float64(50)).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE `users` SET `balance`=\\?,`shard_count`=\\?,`version`=version \\+ 1 WHERE id = \\?").WithArgs(float64(0), 2, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	cfg := testConfig()
+	svc := NewShardService(cfg, repositories.NewUserRepo(db), repositories.NewBalanceShardRepo(db), NewGormTxRunner(cfg, db), db)
+	if _, err := svc.SetShardCount(context.Background(), 1, 2); err == nil {
+		t.Error("expected error while BALANCE_SHARDING_ENABLED is false")
+	}
+
+	cfg.BalanceShardingEnabled = true
+	balance, err := svc.SetShardCount(context.Background(), 1, 2)
+	if err != nil || balance != 100 {
+		t.Errorf("expected balance 100, got %v, %v", balance, err)
+	}
+	if _, err := svc.SetShardCount(context.Background(), 1, 9); err == nil {
+		t.Error("expected error above BALANCE_SHARD_MAX")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,175 +1,234 @@
 package services
 
 import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/gorm"
-	"net/http"
+	"wyvern-api/config"
+	"wyvern-api/metrics"
 	"wyvern-api/models"
+	"wyvern-api/tracing"
 	"wyvern-api/utils"
 )
 
 // TransactionProcessor interface
 type TransactionProcessor interface {
-	Insert(db *gorm.DB, transaction models.Transaction) (models.Transaction, error)
+	Insert(ctx context.Context, db *gorm.DB, transaction models.Transaction) (models.Transaction, error)
+	List(ctx context.Context, db *gorm.DB, filter models.TransactionFilter) ([]models.Transaction, error)
+}
+
+// UserProcessor interface
+type UserProcessor interface {
+	FindByID(ctx context.Context, db *gorm.DB, ID int64) (models.User, error)
+	LockByID(ctx context.Context, db *gorm.DB, ID int64) (models.User, error)
+	AddBalance(ctx context.Context, db *gorm.DB, ID int64, amount float64) error
+	AddBalanceIfVersion(ctx context.Context, db *gorm.DB, ID int64, amount float64, version int64) (bool, error)
 }
 
 // TransactionService struct
 type TransactionService struct {
-	identifier int64
-	tp         TransactionProcessor
-	db         *gorm.DB
+	cfg      *config.Config
+	tp       TransactionProcessor
+	strategy BalanceStrategy
+	runner   TxRunner
+	writer   *AccountWriter
+	db       *gorm.DB
+	replicas *ReplicaRouter
 }
 
-// NewTransactionService initiate TransactionService
-func NewTransactionService(tp TransactionProcessor, db *gorm.DB, identifier int64) *TransactionService {
+// NewTransactionService initiate TransactionService, credits/debits go through writer when it is not nil.
+// History reads from replicas when it is not nil, everything else uses db, the primary.
+func NewTransactionService(cfg *config.Config, tp TransactionProcessor, strategy BalanceStrategy, runner TxRunner, writer *AccountWriter, db *gorm.DB, replicas *ReplicaRouter) *TransactionService {
 	return &TransactionService{
-		identifier: identifier,
-		tp:         tp,
-		db:         db,
+		cfg:      cfg,
+		tp:       tp,
+		strategy: strategy,
+		runner:   runner,
+		writer:   writer,
+		db:       db,
+		replicas: replicas,
 	}
 }
 
 // Credit is method for handle credit process
-func (svc *TransactionService) Credit(req models.CreditRequest) models.ResponseV2 {
-	log := utils.NewLoggerIdentifier("Credit", 1, svc.identifier).Service()
-	log.Info("req: %+v", req)
-
-	tx := svc.db.Begin()
-
-	// Lock the row to prevent concurrent updates
-	var user models.User
-	if err := tx.Raw("SELECT * FROM users WHERE id = ? FOR UPDATE", req.UserID).Scan(&user).Error; err != nil {
-		log.Warn("failed find user, error: %s", err.Error())
-		errMsg := "Data not found"
-		resp := models.ResponseV2{
-			Code:    http.StatusNotFound,
-			Status:  "error",
-			Message: errMsg,
-		}
-		return resp
-	}
-
-	// update user balance
-	if err := tx.Exec("UPDATE users SET balance = balance + ? WHERE id = ?", req.Amount, req.UserID).Error; err != nil {
-		tx.Rollback()
-		log.Warn("failed update user, error: %s", err.Error())
-		errMsg := "Invalid Amount"
-		resp := models.ResponseV2{
-			Code:    http.StatusInternalServerError,
-			Status:  "error",
-			Message: errMsg,
-		}
-		return resp
+func (svc *TransactionService) Credit(ctx context.Context, req models.CreditRequest) (resp models.CreditResponse, err error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.Credit", attribute.Int64("user.id", req.UserID))
+	log := utils.NewLoggerFromContext(ctx, "Credit", 1).Service().AddField("user_id", req.UserID)
+	log.Info("req: %s", utils.Redact(req))
+
+	defer func() {
+		metrics.ObserveTransaction("CREDIT", req.Amount, err)
+		tracing.End(span, err)
+	}()
+
+	if err := svc.checkApproval(req.Amount); err != nil {
+		log.Warn("amount %v above approval threshold", req.Amount)
+		return models.CreditResponse{}, err
 	}
 
-	// insert transactions
 	transaction := models.Transaction{
-		UserID: user.ID,
-		Amount: req.Amount,
-		Type:   "CREDIT",
+		UserID:      req.UserID,
+		Amount:      req.Amount,
+		Type:        "CREDIT",
+		Description: req.Description,
+		Reference:   req.Reference,
+		Category:    req.Category,
+		Metadata:    req.Metadata,
 	}
-	transaction, err := svc.tp.Insert(tx, transaction)
+	transaction, newBalance, err := svc.execute(ctx, transaction, req.Amount)
 	if err != nil {
-		tx.Rollback()
-		log.Warn("failed insert transaction, error: %s", err.Error())
-		errMsg := "Invalid Amount"
-		resp := models.ResponseV2{
-			Code:    http.StatusInternalServerError,
-			Status:  "error",
-			Message: errMsg,
-		}
-		return resp
+		return models.CreditResponse{}, err
 	}
-	tx.Commit()
 
-	newBalance := user.Balance + req.Amount
-	resp := models.ResponseV2{
-		Code:    http.StatusOK,
-		Status:  "success",
-		Message: "",
-		Data: models.CreditResponse{
-			TransactionID: transaction.ID,
-			NewBalance:    newBalance,
-		},
+	resp = models.CreditResponse{
+		TransactionID: transaction.ID,
+		NewBalance:    newBalance,
 	}
 
-	return resp
+	return resp, nil
 }
 
 // Debit is method for handle debit process
-func (svc *TransactionService) Debit(req models.DebitRequest) models.ResponseV2 {
-	log := utils.NewLoggerIdentifier("Credit", 1, svc.identifier).Service()
-	log.Info("req: %+v", req)
-
-	tx := svc.db.Begin()
-
-	// Lock the row to prevent concurrent updates
-	var user models.User
-	if err := tx.Raw("SELECT * FROM users WHERE id = ? FOR UPDATE", req.UserID).Scan(&user).Error; err != nil {
-		log.Warn("failed find user, error: %s", err.Error())
-		errMsg := "Data not found"
-		resp := models.ResponseV2{
-			Code:    http.StatusNotFound,
-			Status:  "error",
-			Message: errMsg,
-		}
-		return resp
+func (svc *TransactionService) Debit(ctx context.Context, req models.DebitRequest) (resp models.DebitResponse, err error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.Debit", attribute.Int64("user.id", req.UserID))
+	log := utils.NewLoggerFromContext(ctx, "Debit", 1).Service().AddField("user_id", req.UserID)
+	log.Info("req: %s", utils.Redact(req))
+
+	defer func() {
+		metrics.ObserveTransaction("DEBIT", req.Amount, err)
+		tracing.End(span, err)
+	}()
+
+	if err := svc.checkApproval(req.Amount); err != nil {
+		log.Warn("amount %v above approval threshold", req.Amount)
+		return models.DebitResponse{}, err
 	}
 
-	// validate balance
-	if user.Balance < req.Amount {
-		errMsg := "Insufficient funds"
-		log.Warn(errMsg)
-		resp := models.ResponseV2{
-			Code:    http.StatusBadRequest,
-			Status:  "error",
-			Message: errMsg,
-		}
-		return resp
-	}
-
-	// update user balance
-	if err := tx.Exec("UPDATE users SET balance = balance - ? WHERE id = ?", req.Amount, req.UserID).Error; err != nil {
-		tx.Rollback()
-		log.Warn("failed update user, error: %s", err.Error())
-		errMsg := "Invalid Amount"
-		resp := models.ResponseV2{
-			Code:    http.StatusInternalServerError,
-			Status:  "error",
-			Message: errMsg,
+	transaction := models.Transaction{
+		UserID:      req.UserID,
+		Amount:      req.Amount,
+		Type:        "DEBIT",
+		Description: req.Description,
+		Reference:   req.Reference,
+		Category:    req.Category,
+		Metadata:    req.Metadata,
+	}
+	transaction, newBalance, err := svc.execute(ctx, transaction, -req.Amount)
+	if err != nil {
+		return models.DebitResponse{}, err
+	}
+
+	resp = models.DebitResponse{
+		TransactionID: transaction.ID,
+		NewBalance:    newBalance,
+	}
+
+	return resp, nil
+}
+
+// checkApproval four-eyes rule, a direct credit/debit above ADJUSTMENT_APPROVAL_THRESHOLD must be an approved
+// adjustment instead
+func (svc *TransactionService) checkApproval(amount float64) error {
+	if svc.cfg.AdjustmentApprovalThreshold > 0 && amount > svc.cfg.AdjustmentApprovalThreshold {
+		return models.ErrApprovalRequired
+	}
+
+	return nil
+}
+
+// execute add delta to the user balance by the balance strategy and record transaction in one database transaction.
+// Every error rolls the whole unit back, the new balance is returned only after commit.
+func (svc *TransactionService) execute(ctx context.Context, transaction models.Transaction, delta float64) (models.Transaction, float64, error) {
+	if svc.writer != nil {
+		return svc.writer.Submit(ctx, transaction, delta)
+	}
+
+	return svc.Execute(ctx, transaction, func(ctx context.Context, tx *gorm.DB) (models.Transaction, float64, error) {
+		return svc.ExecuteTx(ctx, tx, transaction, delta)
+	})
+}
+
+// Execute is method to run unit, a balance change of the user of transaction, in one database transaction: on the
+// worker owning the user in single writer mode, in a transaction of its own otherwise.
+// Build unit on ExecuteTx, so the balance strategy guards the balance in both modes.
+func (svc *TransactionService) Execute(ctx context.Context, transaction models.Transaction, unit WriteUnit) (models.Transaction, float64, error) {
+	if svc.writer != nil {
+		return svc.writer.SubmitUnit(ctx, transaction, unit)
+	}
+
+	// the transaction is rolled back when ctx is canceled or the deadline passes
+	ctx, cancel := withTimeout(ctx, svc.cfg.DbTransactionTimeout)
+	defer cancel()
+	ctx = utils.ContextWithTxType(ctx, transaction.Type)
+
+	// the unit of work may run again after a deadlock, it only sets the results once everything succeeded
+	var inserted models.Transaction
+	var newBalance float64
+	err := svc.runner.Run(ctx, func(tx *gorm.DB) error {
+		record, balance, err := unit(ctx, tx)
+		if err != nil {
+			return err
 		}
-		return resp
+
+		inserted, newBalance = record, balance
+		return nil
+	})
+	if err != nil {
+		return transaction, 0, err
 	}
 
-	// insert transactions
-	transaction := models.Transaction{
-		UserID: user.ID,
-		Amount: req.Amount,
-		Type:   "DEBIT",
+	return inserted, newBalance, nil
+}
+
+// ExecuteTx is method to add delta to the user balance by the balance strategy and record transaction inside tx,
+// a transaction of the caller. Both are committed or rolled back with whatever else the caller does in tx.
+func (svc *TransactionService) ExecuteTx(ctx context.Context, tx *gorm.DB, transaction models.Transaction, delta float64) (models.Transaction, float64, error) {
+	log := utils.NewLoggerFromContext(ctx, transaction.Type, 2).Service().AddField("user_id", transaction.UserID)
+
+	user, err := svc.strategy.Apply(ctx, tx, transaction.UserID, delta)
+	if err != nil {
+		return transaction, 0, err
 	}
-	transaction, err := svc.tp.Insert(tx, transaction)
+
+	// insert transactions
+	record, err := svc.tp.Insert(ctx, tx, transaction)
 	if err != nil {
-		tx.Rollback()
 		log.Warn("failed insert transaction, error: %s", err.Error())
-		errMsg := "Invalid Amount"
-		resp := models.ResponseV2{
-			Code:    http.StatusInternalServerError,
-			Status:  "error",
-			Message: errMsg,
-		}
-		return resp
+		return transaction, 0, dbError(ctx, err, models.ErrTransactionNotCreated)
 	}
-	tx.Commit()
 
-	newBalance := user.Balance - req.Amount
-	resp := models.ResponseV2{
-		Code:    http.StatusOK,
-		Status:  "success",
-		Message: "",
-		Data: models.CreditResponse{
-			TransactionID: transaction.ID,
-			NewBalance:    newBalance,
-		},
+	return record, user.Balance, nil
+}
+
+// History is method for query transaction history
+func (svc *TransactionService) History(ctx context.Context, filter models.TransactionFilter) (transactions []models.Transaction, err error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.History")
+	defer func() { tracing.End(span, err) }()
+
+	log := utils.NewLoggerFromContext(ctx, "History", 1).Service()
+	log.Info("filter: %+v", filter)
+
+	if filter.Limit <= 0 || filter.Limit > 100 {
+		filter.Limit = 100
+	}
+
+	ctx, cancel := withTimeout(ctx, svc.cfg.DbQueryTimeout)
+	defer cancel()
+
+	transactions, err = svc.tp.List(ctx, contextDB(svc.readDB(), ctx), filter)
+	if err != nil {
+		log.Warn("failed list transactions, error: %s", err.Error())
+		return transactions, dbError(ctx, err, models.ErrDatabase)
+	}
+
+	return transactions, nil
+}
+
+// readDB is method to pick the database for reads that may lag behind a just committed write
+func (svc *TransactionService) readDB() *gorm.DB {
+	if svc.replicas == nil {
+		return svc.db
 	}
 
-	return resp
+	return svc.replicas.Reader()
 }
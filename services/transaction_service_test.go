@@ -1,17 +1,19 @@
 package services
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"gorm.io/driver/mysql"
+	"context"
+	"errors"
 	"gorm.io/gorm"
-	"log"
-	"net/http"
+	"os"
 	"sync"
 	"testing"
 	"time"
+	"wyvern-api/config"
+	"wyvern-api/dialects"
+	"wyvern-api/migrations"
 	"wyvern-api/models"
+	"wyvern-api/repositories"
+	"wyvern-api/utils"
 )
 
 var DBMock *gorm.DB
@@ -25,75 +27,304 @@ const (
 	DB_DEBUG    = true
 )
 
+// testDBDriver driver of TEST_DB_DRIVER, SQLite by default
+func testDBDriver() string {
+	if driver := os.Getenv("TEST_DB_DRIVER"); driver != "" {
+		return driver
+	}
+
+	return dialects.DriverSQLite
+}
+
+// MockLoadDatabase open the database of TEST_DB_DRIVER, an in-memory SQLite database by default,
+// and migrate it
 func MockLoadDatabase() {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", DB_USERNAME, DB_PASSWORD, DB_URL, DB_PORT, DB_DATABASE)
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	driver := testDBDriver()
+	dialect, err := dialects.Get(driver)
+	if err != nil {
+		panic(err)
+	}
+
+	conn := dialects.Connection{Host: DB_URL, Port: DB_PORT, Username: DB_USERNAME, Password: DB_PASSWORD, Database: DB_DATABASE}
+	switch driver {
+	case dialects.DriverSQLite:
+		conn.Database = ":memory:"
+	case dialects.DriverPostgres:
+		conn.Username, conn.Port = "postgres", "5432"
+	}
+	db, err := gorm.Open(dialect.Dialector(conn), &gorm.Config{})
 	if err != nil {
 		panic("failed to connect database")
 	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		panic("failed to connect database")
+	}
+	dialect.Configure(sqlDB)
+
+	migrator, err := migrations.New(db, time.Minute)
+	if err != nil {
+		panic(err)
+	}
+	if err := migrator.Up(context.Background()); err != nil {
+		panic(err)
+	}
 
 	DBMock = db
 }
 
+// TestTransactionService_Concurrent credit one user from many goroutines with every balance strategy and
+// in single writer mode, no credit may be lost.
+//
+// On the default SQLite database it only checks the retry and accounting path: SQLite has no row locks, the
+// pessimistic strategy's SELECT ... FOR UPDATE is a no-op there and MaxOpenConns=1 runs every transaction alone.
+// Run it with TEST_DB_DRIVER=mysql or TEST_DB_DRIVER=postgres to check the row lock and version conflicts.
 func TestTransactionService_Concurrent(t *testing.T) {
 	MockLoadDatabase()
-	user := models.User{Username: "Fulan"}
-	DBMock.Create(&user)
+	if testDBDriver() == dialects.DriverSQLite {
+		t.Log("SQLite serializes every transaction, row locking is not exercised, set TEST_DB_DRIVER to check it")
+	}
+	cfg := &config.Config{
+		DbTransactionTimeout:  30 * time.Second,
+		DbLockWaitTimeout:     10 * time.Second,
+		DbRetryMaxAttempts:    1000, // optimistic writers on one row conflict a lot
+		DbRetryBaseDelay:      time.Millisecond,
+		DbRetryMaxDelay:       20 * time.Millisecond,
+		SingleWriterShards:    16,
+		SingleWriterMaxBatch:  100,
+		SingleWriterQueueSize: 1000,
+	}
+
+	modes := []struct {
+		name         string
+		strategy     string
+		singleWriter bool
+	}{
+		{"pessimistic", BalanceStrategyPessimistic, false},
+		{"optimistic", BalanceStrategyOptimistic, false},
+		{"single writer", BalanceStrategyPessimistic, true},
+	}
 
-	apiURL := "http://127.0.0.1:8080/api/transactions/credit"
-	var wg sync.WaitGroup
-	client := &http.Client{Timeout: 10 * time.Second}
+	for _, mode := range modes {
+		t.Run(mode.name, func(t *testing.T) {
+			user := models.User{Username: "Fulan"}
+			DBMock.Create(&user)
 
-	creditAmount := 1000
-	numRequests := 100     // Number of concurrent requests
-	numTransactions := 100 // each request do 100 trx
-	wg.Add(numRequests)    // Add all Goroutines to WaitGroup
+			strategy, err := NewBalanceStrategy(mode.strategy, repositories.NewUserRepo(DBMock), cfg.DbLockWaitTimeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var writer *AccountWriter
+			if mode.singleWriter {
+				workers := utils.NewWorkers()
+				defer workers.Stop(context.Background())
+				writer = NewAccountWriter(cfg, repositories.NewTransactionRepo(DBMock), strategy, NewGormTxRunner(cfg, DBMock))
+				writer.Start(workers)
+			}
+			svc := NewTransactionService(cfg, repositories.NewTransactionRepo(DBMock), strategy, NewGormTxRunner(cfg, DBMock), writer, DBMock, nil)
 
-	req := models.CreditRequest{
-		UserID: user.ID,
-		Amount: float64(creditAmount),
+			var wg sync.WaitGroup
+			creditAmount := 1000
+			numRequests := 100     // Number of concurrent requests
+			numTransactions := 100 // each request do 100 trx
+			wg.Add(numRequests)    // Add all Goroutines to WaitGroup
+
+			req := models.CreditRequest{
+				UserID: user.ID,
+				Amount: float64(creditAmount),
+			}
+
+			for i := 0; i < numRequests; i++ {
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < numTransactions; j++ {
+						if _, err := svc.Credit(context.Background(), req); err != nil {
+							t.Errorf("Request %d failed: %v", i, err)
+						}
+					}
+				}(i)
+			}
+
+			wg.Wait()
+
+			// validate balance
+			var updatedUser models.User
+			DBMock.First(&updatedUser, user.ID)
+
+			expectedBalance := float64(numRequests * numTransactions * creditAmount) // 100 * 100 * 1000 = 10.000.000
+			if updatedUser.Balance != expectedBalance {
+				t.Errorf("Balance does not match: expected %v, got %v", expectedBalance, updatedUser.Balance)
+			}
+		})
 	}
-	jsonData, err := json.Marshal(req)
+}
+
+// failingInserts TransactionProcessor failing every insert
+type failingInserts struct {
+	TransactionProcessor
+}
+
+func (failingInserts) Insert(context.Context, *gorm.DB, models.Transaction) (models.Transaction, error) {
+	return models.Transaction{}, errors.New("disk full")
+}
+
+// newMemoryTransactionService TransactionService of strategy on a MemoryStore holding one user of balance
+func newMemoryTransactionService(t *testing.T, strategy string, balance float64, tp func(store *repositories.MemoryStore) TransactionProcessor) (*TransactionService, *repositories.MemoryStore) {
+	t.Helper()
+
+	store := repositories.NewMemoryStore()
+	store.AddUser(models.User{ID: 1, Username: "Fulan", Balance: balance})
+	balanceStrategy, err := NewBalanceStrategy(strategy, repositories.NewMemoryUserRepo(store), 0)
 	if err != nil {
-		log.Fatalf("Error encoding JSON: %v", err)
+		t.Fatal(err)
 	}
 
-	for i := 0; i < numRequests; i++ {
-		go func() {
-			defer wg.Done()
-			for j := 0; j < numTransactions; j++ {
-				// Create a new request
-				req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
+	return NewTransactionService(testConfig(), tp(store), balanceStrategy, store, nil, store.DB(), nil), store
+}
+
+// TestTransactionService_Rules business rules of credit and debit on in-memory repositories, every strategy
+func TestTransactionService_Rules(t *testing.T) {
+	memoryTransactions := func(store *repositories.MemoryStore) TransactionProcessor {
+		return repositories.NewMemoryTransactionRepo(store)
+	}
+	failing := func(store *repositories.MemoryStore) TransactionProcessor {
+		return failingInserts{repositories.NewMemoryTransactionRepo(store)}
+	}
+	balanceOf := func(t *testing.T, store *repositories.MemoryStore) float64 {
+		user, err := repositories.NewMemoryUserRepo(store).FindByID(context.Background(), store.DB(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.Balance
+	}
+
+	for _, strategy := range []string{BalanceStrategyPessimistic, BalanceStrategyOptimistic} {
+		t.Run(strategy, func(t *testing.T) {
+			t.Run("debit within balance", func(t *testing.T) {
+				svc, store := newMemoryTransactionService(t, strategy, 100, memoryTransactions)
+				resp, err := svc.Debit(context.Background(), models.DebitRequest{UserID: 1, Amount: 40})
 				if err != nil {
-					t.Errorf("Request creation failed: %v", err)
-					return
+					t.Fatal(err)
+				}
+				if resp.TransactionID != 1 || resp.NewBalance != 60 || balanceOf(t, store) != 60 {
+					t.Errorf("expected transaction 1 with balance 60, got %+v", resp)
 				}
 
-				// Send request
-				resp, err := client.Do(req)
-				if err != nil {
-					t.Errorf("Request %d failed: %v", i, err)
-					return
+				history, err := svc.History(context.Background(), models.TransactionFilter{UserID: 1})
+				if err != nil || len(history) != 1 || history[0].Type != "DEBIT" {
+					t.Errorf("expected one debit in history, got %+v, %v", history, err)
 				}
-				defer resp.Body.Close()
+			})
 
-				// Validate response status code
-				if resp.StatusCode != http.StatusOK {
-					t.Errorf("Request %d failed: expected 200, got %d", i, resp.StatusCode)
+			t.Run("insufficient funds", func(t *testing.T) {
+				svc, store := newMemoryTransactionService(t, strategy, 100, memoryTransactions)
+				_, err := svc.Debit(context.Background(), models.DebitRequest{UserID: 1, Amount: 100.01})
+				if !errors.Is(err, models.ErrInsufficientFunds) {
+					t.Fatalf("expected %s, got %v", models.ErrInsufficientFunds.Code, err)
 				}
-			}
-		}()
-	}
+				if balanceOf(t, store) != 100 {
+					t.Errorf("expected balance 100, got %v", balanceOf(t, store))
+				}
+			})
 
-	wg.Wait()
+			t.Run("user not found", func(t *testing.T) {
+				svc, _ := newMemoryTransactionService(t, strategy, 100, memoryTransactions)
+				_, err := svc.Credit(context.Background(), models.CreditRequest{UserID: 2, Amount: 10})
+				if !errors.Is(err, models.ErrUserNotFound) {
+					t.Fatalf("expected %s, got %v", models.ErrUserNotFound.Code, err)
+				}
+			})
 
-	// validate balance
-	var updatedUser models.User
-	DBMock.First(&updatedUser, user.ID)
+			t.Run("failed insert rolls the balance back", func(t *testing.T) {
+				svc, store := newMemoryTransactionService(t, strategy, 100, failing)
+				_, err := svc.Credit(context.Background(), models.CreditRequest{UserID: 1, Amount: 10})
+				if !errors.Is(err, models.ErrTransactionNotCreated) {
+					t.Fatalf("expected %s, got %v", models.ErrTransactionNotCreated.Code, err)
+				}
+				if balanceOf(t, store) != 100 {
+					t.Errorf("expected balance 100, got %v", balanceOf(t, store))
+				}
 
-	expectedBalance := float64(numRequests * numTransactions * creditAmount) // 100 * 100 * 1000 = 10.000.000
-	if updatedUser.Balance != expectedBalance {
-		t.Errorf("Balance does not match: expected %v, got %v", expectedBalance, updatedUser.Balance)
+				// the row lock went with the rollback
+				if _, err := repositories.NewMemoryUserRepo(store).LockByID(context.Background(), store.DB(), 1); err != nil {
+					t.Errorf("expected row unlocked, got %v", err)
+				}
+			})
+		})
 	}
-	fmt.Printf("User balance is match!")
+
+	t.Run("approval threshold", func(t *testing.T) {
+		svc, store := newMemoryTransactionService(t, BalanceStrategyPessimistic, 1000, memoryTransactions)
+		svc.cfg.AdjustmentApprovalThreshold = 100
+
+		if _, err := svc.Credit(context.Background(), models.CreditRequest{UserID: 1, Amount: 100}); err != nil {
+			t.Fatalf("expected credit at the threshold, got %v", err)
+		}
+		if _, err := svc.Debit(context.Background(), models.DebitRequest{UserID: 1, Amount: 100}); err != nil {
+			t.Fatalf("expected debit at the threshold, got %v", err)
+		}
+		if _, err := svc.Credit(context.Background(), models.CreditRequest{UserID: 1, Amount: 100.01}); !errors.Is(err, models.ErrApprovalRequired) {
+			t.Errorf("expected %s for credit above the threshold, got %v", models.ErrApprovalRequired.Code, err)
+		}
+		if _, err := svc.Debit(context.Background(), models.DebitRequest{UserID: 1, Amount: 100.01}); !errors.Is(err, models.ErrApprovalRequired) {
+			t.Errorf("expected %s for debit above the threshold, got %v", models.ErrApprovalRequired.Code, err)
+		}
+		if balanceOf(t, store) != 1000 {
+			t.Errorf("expected balance 1000, got %v", balanceOf(t, store))
+		}
+	})
+
+	t.Run("row lock serializes concurrent debits", func(t *testing.T) {
+		svc, store := newMemoryTransactionService(t, BalanceStrategyPessimistic, 100, memoryTransactions)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		failed := 0
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := svc.Debit(context.Background(), models.DebitRequest{UserID: 1, Amount: 3}); errors.Is(err, models.ErrInsufficientFunds) {
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				} else if err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		// 33 debits of 3 fit in 100, the rest must see the balance they left
+		if failed != 17 || balanceOf(t, store) != 1 {
+			t.Errorf("expected 17 rejected debits and balance 1, got %d and %v", failed, balanceOf(t, store))
+		}
+	})
+
+	t.Run("lock wait ends with the context", func(t *testing.T) {
+		store := repositories.NewMemoryStore()
+		store.AddUser(models.User{ID: 1})
+		users := repositories.NewMemoryUserRepo(store)
+
+		release := make(chan struct{})
+		locked := make(chan struct{})
+		go store.Run(context.Background(), func(tx *gorm.DB) error {
+			_, err := users.LockByID(context.Background(), tx, 1)
+			close(locked)
+			<-release
+			return err
+		})
+		<-locked
+		defer close(release)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := store.Run(ctx, func(tx *gorm.DB) error {
+			_, err := users.LockByID(ctx, tx, 1)
+			return err
+		})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected deadline exceeded, got %v", err)
+		}
+	})
 }
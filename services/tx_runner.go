@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+	"wyvern-api/config"
+	"wyvern-api/metrics"
+	"wyvern-api/models"
+	"wyvern-api/utils"
+)
+
+// TxRunner run a unit of work in one database transaction
+type TxRunner interface {
+	Run(ctx context.Context, fn func(tx *gorm.DB) error) error
+}
+
+// DBTransactionType* type label of database transactions not labeled by utils.ContextWithTxType
+const (
+	DBTransactionTypeBatch = "BATCH"
+	DBTransactionTypeOther = "OTHER"
+)
+
+// GormTxRunner TxRunner on a gorm connection
+type GormTxRunner struct {
+	db    *gorm.DB
+	retry RetryPolicy
+}
+
+// NewGormTxRunner initiate GormTxRunner, retrying by DB_RETRY_* of cfg
+func NewGormTxRunner(cfg *config.Config, db *gorm.DB) *GormTxRunner {
+	return &GormTxRunner{
+		db: db,
+		retry: RetryPolicy{
+			MaxAttempts: cfg.DbRetryMaxAttempts,
+			BaseDelay:   cfg.DbRetryBaseDelay,
+			MaxDelay:    cfg.DbRetryMaxDelay,
+		},
+	}
+}
+
+// Run begin a transaction bound to ctx and pass it to fn. The transaction is committed only when fn returns nil,
+// it is rolled back when fn returns an error or panics, and a failed commit is returned as error.
+//
+// After a deadlock or lock wait timeout the whole fn is run again in a new transaction, so fn must not keep
+// state from a previous attempt. A failed commit is never retried, its outcome is unknown.
+func (r *GormTxRunner) Run(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	log := utils.NewLoggerFromContext(ctx, "TxRunner", 1).Service()
+
+	for attempt := 1; ; attempt++ {
+		committing, err := r.runOnce(ctx, fn, log)
+		if err == nil || committing || attempt >= r.retry.MaxAttempts || !isRetryable(err) {
+			return err
+		}
+
+		reason := retryReason(err)
+		delay := r.retry.backoff(attempt)
+		metrics.Retry(reason)
+		log.Warn("retry transaction after %s, attempt %d/%d in %s, error: %s", reason, attempt+1, r.retry.MaxAttempts, delay, err.Error())
+
+		select {
+		case <-ctx.Done():
+			return dbError(ctx, ctx.Err(), models.ErrDatabase)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// runOnce run fn in one transaction, committing is true when the error comes from commit
+func (r *GormTxRunner) runOnce(ctx context.Context, fn func(tx *gorm.DB) error, log *utils.Logger) (committing bool, err error) {
+	txType := utils.TxTypeFromContext(ctx)
+	if txType == "" {
+		txType = DBTransactionTypeOther
+	}
+
+	begin := time.Now()
+	tx := contextDB(r.db, ctx).Begin()
+	if tx.Error != nil {
+		log.Warn("failed begin transaction, error: %s", tx.Error.Error())
+		return false, dbError(ctx, tx.Error, models.ErrDatabase)
+	}
+	// deferred first, so it runs after the commit or the rollback below
+	defer metrics.ObserveDBTransaction(txType, begin)
+
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+
+		reason := rollbackReason(err)
+		p := recover()
+		if p != nil {
+			reason = "panic"
+		}
+
+		// ErrTxDone means database/sql already rolled back because ctx ended
+		if rollbackErr := tx.Rollback().Error; rollbackErr != nil && !errors.Is(rollbackErr, gorm.ErrInvalidTransaction) && !errors.Is(rollbackErr, sql.ErrTxDone) {
+			log.Error("failed rollback transaction, error: %s", rollbackErr.Error())
+		}
+		metrics.Rollback(reason)
+
+		if p != nil {
+			panic(p)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		return false, err
+	}
+
+	if commitErr := tx.Commit().Error; commitErr != nil {
+		log.Error("failed commit transaction, error: %s", commitErr.Error())
+		return true, models.ErrCommitFailed.Wrap(commitErr)
+	}
+	committed = true
+
+	return false, nil
+}
+
+// rollbackReason metric label of the error that rolled back the transaction
+func rollbackReason(err error) string {
+	if errors.Is(err, models.ErrCommitFailed) {
+		return "commit_failed"
+	}
+
+	return strings.ToLower(models.AsAppError(err).Code)
+}
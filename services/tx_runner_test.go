@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	mysqlerr "github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"testing"
+	"time"
+	"wyvern-api/config"
+	"wyvern-api/metrics"
+	"wyvern-api/models"
+	"wyvern-api/repositories"
+	"wyvern-api/utils"
+)
+
+const (
+	lockUserSQL       = "SELECT \\* FROM `users` WHERE `users`.`id` = \\? .*FOR UPDATE"
+	addBalanceSQL     = "UPDATE `users` SET `balance`=balance \\+ \\?"
+	insertTransaction = "INSERT INTO `transactions`"
+)
+
+// testConfig config of a service under test: no deadlines, one attempt per transaction, amounts of 2 decimals
+func testConfig() *config.Config {
+	return &config.Config{
+		DbRetryMaxAttempts:         1,
+		TransactionAmountPrecision: 2,
+		BalanceShardMax:            8,
+		AdjustmentTTL:              time.Hour,
+	}
+}
+
+// newSQLMock gorm connection on sqlmock, every statement must be expected by the test
+func newSQLMock(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db, mock
+}
+
+func userRows(balance float64, status string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "username", "balance", "status"}).AddRow(1, "Fulan", balance, status)
+}
+
+func TestGormTxRunner(t *testing.T) {
+	failure := errors.New("boom")
+
+	t.Run("commit when fn succeeds", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		if err := NewGormTxRunner(testConfig(), db).Run(context.Background(), func(tx *gorm.DB) error { return nil }); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("rollback when fn fails", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		err := NewGormTxRunner(testConfig(), db).Run(context.Background(), func(tx *gorm.DB) error { return failure })
+		if !errors.Is(err, failure) {
+			t.Fatalf("expected fn error, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("rollback and repanic when fn panics", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("expected panic to be propagated, got %v", p)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		}()
+		_ = NewGormTxRunner(testConfig(), db).Run(context.Background(), func(tx *gorm.DB) error { panic("boom") })
+	})
+
+	t.Run("commit failure is returned", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectCommit().WillReturnError(failure)
+
+		err := NewGormTxRunner(testConfig(), db).Run(context.Background(), func(tx *gorm.DB) error { return nil })
+		if !errors.Is(err, models.ErrCommitFailed) {
+			t.Fatalf("expected %s, got %v", models.ErrCommitFailed.Code, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("begin failure is returned", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin().WillReturnError(failure)
+
+		called := false
+		err := NewGormTxRunner(testConfig(), db).Run(context.Background(), func(tx *gorm.DB) error { called = true; return nil })
+		if !errors.Is(err, models.ErrDatabase) || called {
+			t.Fatalf("expected %s without running fn, got %v", models.ErrDatabase.Code, err)
+		}
+	})
+}
+
+// dbTransactions number of database transactions observed with txType
+func dbTransactions(t *testing.T, txType string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := metrics.DBTransactionDuration.WithLabelValues(txType).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestGormTxRunner_Duration(t *testing.T) {
+	db, mock := newSQLMock(t)
+	runner := NewGormTxRunner(testConfig(), db)
+	credits, others := dbTransactions(t, "CREDIT"), dbTransactions(t, DBTransactionTypeOther)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin().WillReturnError(errors.New("boom"))
+
+	_ = runner.Run(utils.ContextWithTxType(context.Background(), "CREDIT"), func(tx *gorm.DB) error { return nil })
+	_ = runner.Run(context.Background(), func(tx *gorm.DB) error { return models.ErrUserNotFound })
+	_ = runner.Run(context.Background(), func(tx *gorm.DB) error { return nil })
+
+	// committed and rolled back transactions count, one that never began does not
+	if got := dbTransactions(t, "CREDIT") - credits; got != 1 {
+		t.Errorf("expected 1 CREDIT transaction observed, got %d", got)
+	}
+	if got := dbTransactions(t, DBTransactionTypeOther) - others; got != 1 {
+		t.Errorf("expected 1 %s transaction observed, got %d", DBTransactionTypeOther, got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTransactionService_DebitRollback(t *testing.T) {
+	failure := errors.New("boom")
+
+	tests := []struct {
+		name   string
+		expect func(mock sqlmock.Sqlmock)
+		want   *models.AppError
+	}{
+		{"lock user fails", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(lockUserSQL).WillReturnError(failure)
+			mock.ExpectRollback()
+		}, models.ErrDatabase},
+		{"user not found", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(lockUserSQL).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectRollback()
+		}, models.ErrUserNotFound},
+		{"account frozen", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(500, models.UserStatusFrozen))
+			mock.ExpectRollback()
+		}, models.ErrAccountFrozen},
+		{"insufficient funds", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(50, models.UserStatusActive))
+			mock.ExpectRollback()
+		}, models.ErrInsufficientFunds},
+		{"update balance fails", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(500, models.UserStatusActive))
+			mock.ExpectExec(addBalanceSQL).WillReturnError(failure)
+			mock.ExpectRollback()
+		}, models.ErrDatabase},
+		{"insert transaction fails", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(500, models.UserStatusActive))
+			mock.ExpectExec(addBalanceSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(insertTransaction).WillReturnError(failure)
+			mock.ExpectRollback()
+		}, models.ErrTransactionNotCreated},
+		{"commit fails", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(500, models.UserStatusActive))
+			mock.ExpectExec(addBalanceSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(insertTransaction).WillReturnResult(sqlmock.NewResult(10, 1))
+			mock.ExpectCommit().WillReturnError(failure)
+		}, models.ErrCommitFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newSQLMock(t)
+			mock.ExpectBegin()
+			tt.expect(mock)
+
+			svc := NewTransactionService(testConfig(), repositories.NewTransactionRepo(db), NewPessimisticStrategy(repositories.NewUserRepo(db), 0), NewGormTxRunner(testConfig(), db), nil, db, nil)
+			resp, err := svc.Debit(context.Background(), models.DebitRequest{UserID: 1, Amount: 100})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %s, got %v", tt.want.Code, err)
+			}
+			if resp.TransactionID != 0 {
+				t.Errorf("expected no transaction id on failure, got %d", resp.TransactionID)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTransactionService_DebitCommit(t *testing.T) {
+	db, mock := newSQLMock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(500, models.UserStatusActive))
+	mock.ExpectExec(addBalanceSQL).WithArgs(float64(-100), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertTransaction).WillReturnResult(sqlmock.NewResult(10, 1))
+	mock.ExpectCommit()
+
+	svc := NewTransactionService(testConfig(), repositories.NewTransactionRepo(db), NewPessimisticStrategy(repositories.NewUserRepo(db), 0), NewGormTxRunner(testConfig(), db), nil, db, nil)
+	resp, err := svc.Debit(context.Background(), models.DebitRequest{UserID: 1, Amount: 100})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.TransactionID != 10 || resp.NewBalance != 400 {
+		t.Errorf("expected transaction 10 with balance 400, got %+v", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGormTxRunner_Retry(t *testing.T) {
+	deadlock := &mysqlerr.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	lockWait := &mysqlerr.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}
+
+	t.Run("deadlock is re-run from the start", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockUserSQL).WillReturnError(deadlock)
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockUserSQL).WillReturnRows(userRows(500, models.UserStatusActive))
+		mock.ExpectExec(addBalanceSQL).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(insertTransaction).WillReturnResult(sqlmock.NewResult(11, 1))
+		mock.ExpectCommit()
+
+		runner := &GormTxRunner{db: db, retry: RetryPolicy{MaxAttempts: 3}}
+		svc := NewTransactionService(testConfig(), repositories.NewTransactionRepo(db), NewPessimisticStrategy(repositories.NewUserRepo(db), 0), runner, nil, db, nil)
+		resp, err := svc.Credit(context.Background(), models.CreditRequest{UserID: 1, Amount: 100})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if resp.TransactionID != 11 || resp.NewBalance != 600 {
+			t.Errorf("expected transaction 11 with balance 600, got %+v", resp)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		for i := 0; i < 2; i++ {
+			mock.ExpectBegin()
+			mock.ExpectQuery(lockUserSQL).WillReturnError(lockWait)
+			mock.ExpectRollback()
+		}
+
+		runner := &GormTxRunner{db: db, retry: RetryPolicy{MaxAttempts: 2}}
+		svc := NewTransactionService(testConfig(), repositories.NewTransactionRepo(db), NewPessimisticStrategy(repositories.NewUserRepo(db), 0), runner, nil, db, nil)
+		_, err := svc.Credit(context.Background(), models.CreditRequest{UserID: 1, Amount: 100})
+		if !errors.Is(err, models.ErrLockConflict) {
+			t.Fatalf("expected %s, got %v", models.ErrLockConflict.Code, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("other errors are not retried", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		attempts := 0
+		runner := &GormTxRunner{db: db, retry: RetryPolicy{MaxAttempts: 3}}
+		err := runner.Run(context.Background(), func(tx *gorm.DB) error { attempts++; return models.ErrInsufficientFunds })
+		if !errors.Is(err, models.ErrInsufficientFunds) || attempts != 1 {
+			t.Fatalf("expected one attempt failing with %s, got %d attempts and %v", models.ErrInsufficientFunds.Code, attempts, err)
+		}
+	})
+
+	t.Run("failed commit is not retried", func(t *testing.T) {
+		db, mock := newSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectCommit().WillReturnError(deadlock)
+
+		attempts := 0
+		runner := &GormTxRunner{db: db, retry: RetryPolicy{MaxAttempts: 3}}
+		err := runner.Run(context.Background(), func(tx *gorm.DB) error { attempts++; return nil })
+		if !errors.Is(err, models.ErrCommitFailed) || attempts != 1 {
+			t.Fatalf("expected one attempt failing with %s, got %d attempts and %v", models.ErrCommitFailed.Code, attempts, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 20 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 10 * time.Millisecond, 20 * time.Millisecond},
+		{2, 20 * time.Millisecond, 40 * time.Millisecond},
+		{3, 25 * time.Millisecond, 50 * time.Millisecond},
+		{40, 25 * time.Millisecond, 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if got := policy.backoff(tt.attempt); got < tt.min || got > tt.max {
+				t.Fatalf("attempt %d: expected delay in [%s, %s], got %s", tt.attempt, tt.min, tt.max, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "tracing:span"
+
+// GormPlugin gorm plugin that wrap every SQL statement in a span, child of the statement context
+type GormPlugin struct{}
+
+// NewGormPlugin initiate GormPlugin
+func NewGormPlugin() *GormPlugin {
+	return &GormPlugin{}
+}
+
+// Name implement gorm.Plugin
+func (p *GormPlugin) Name() string {
+	return "tracing"
+}
+
+// Initialize implement gorm.Plugin
+func (p *GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	registers := []error{
+		cb.Create().Before("gorm:create").Register("tracing:before_create", startSQLSpan("create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", endSQLSpan),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", startSQLSpan("query")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", endSQLSpan),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", startSQLSpan("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", endSQLSpan),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", startSQLSpan("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", endSQLSpan),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", startSQLSpan("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", endSQLSpan),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", startSQLSpan("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", endSQLSpan),
+	}
+
+	return errors.Join(registers...)
+}
+
+// startSQLSpan start span before statement runs
+func startSQLSpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx, span := Start(db.Statement.Context, "sql."+operation,
+			attribute.String("db.system", db.Dialector.Name()),
+			attribute.String("db.operation", operation),
+		)
+		db.Statement.Context = ctx
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+// endSQLSpan end span after statement with the statement and its result
+func endSQLSpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("db.statement", db.Statement.SQL.String()),
+		attribute.String("db.sql.table", db.Statement.Table),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+
+	err := db.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	End(span, err)
+}
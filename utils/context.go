@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+type contextKey string
+
+// requestIDKey context key of the request id
+const requestIDKey contextKey = "request_id"
+
+// ContextWithRequestID return copy of ctx carrying request id
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestIDFromContext get request id from ctx, empty when there is none
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// operatorKey context key of the authenticated operator
+const operatorKey contextKey = "operator"
+
+// ContextWithOperator return copy of ctx carrying the authenticated operator
+func ContextWithOperator(ctx context.Context, operator string) context.Context {
+	return context.WithValue(ctx, operatorKey, operator)
+}
+
+// OperatorFromContext get authenticated operator from ctx, empty when there is none
+func OperatorFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	operator, _ := ctx.Value(operatorKey).(string)
+	return operator
+}
+
+// txTypeKey context key of the type of the database transaction, a metric label
+const txTypeKey contextKey = "tx_type"
+
+// ContextWithTxType return copy of ctx labeling the database transactions run with it as txType
+func ContextWithTxType(ctx context.Context, txType string) context.Context {
+	return context.WithValue(ctx, txTypeKey, txType)
+}
+
+// TxTypeFromContext get database transaction type from ctx, empty when there is none
+func TxTypeFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	txType, _ := ctx.Value(txTypeKey).(string)
+	return txType
+}
+
+// errorFormatKey context key of the configured ERROR_FORMAT
+const errorFormatKey contextKey = "error_format"
+
+// ContextWithErrorFormat return copy of ctx carrying the error format responses are written in
+func ContextWithErrorFormat(ctx context.Context, format string) context.Context {
+	return context.WithValue(ctx, errorFormatKey, format)
+}
+
+// ErrorFormatFromContext get error format from ctx, empty when there is none
+func ErrorFormatFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	format, _ := ctx.Value(errorFormatKey).(string)
+	return format
+}
+
+// NewRequestID generate random 128 bit request id as 32 hex chars
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on supported platforms, keep the request going anyway
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -1,12 +1,14 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,6 +16,8 @@ import (
 	"wyvern-api/config"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 /**
@@ -39,9 +43,10 @@ const (
 )
 
 var (
-	log     *logrus.Logger
-	once    sync.Once
-	logFile *os.File
+	log        = logrus.StandardLogger()
+	once       sync.Once
+	logFile    *lumberjack.Logger
+	jsonFormat bool
 )
 
 // DefaultFormatter struct
@@ -49,7 +54,7 @@ type DefaultFormatter struct {
 	*logrus.TextFormatter
 }
 
-// Format func to override format
+// Format func to override format, fields are appended as sorted key=value
 func (f *DefaultFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	timestamp := entry.Time.Format(DefaultLogDateFormat)
 	level := strings.ToUpper(entry.Level.String())[0:1]
@@ -57,33 +62,41 @@ func (f *DefaultFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	//funcName := fmt.Sprintf("%s()", entry.Caller.Function)
 	msg := entry.Message
 
+	fields := RedactFields(entry.Data)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		msg = fmt.Sprintf("%s %s=%v", msg, key, fields[key])
+	}
+
 	return []byte(fmt.Sprintf("%s [%s] %s\n", timestamp, level, msg)), nil
 }
 
+// JSONFormatter one JSON object per line, fields are kept as keys and sensitive ones redacted
+type JSONFormatter struct {
+	logrus.JSONFormatter
+}
+
+// Format func to redact fields before encoding, on a copy of entry, hooks and other formatters still see the fields
+func (f *JSONFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	redacted := *entry
+	redacted.Data = RedactFields(entry.Data)
+	return f.JSONFormatter.Format(&redacted)
+}
+
 // InitLogger func
 func InitLogger() {
 	once.Do(func() {
-		log = logrus.New()
 		logFileName := config.GetString("LOGGING_FILE_NAME", "logs/app.log")
 
-		switch config.GetString("LOGGING_LEVEL", "debug") {
-		case "debug":
-			logrus.SetLevel(logrus.DebugLevel)
-		case "info":
-			logrus.SetLevel(logrus.InfoLevel)
-		case "warn":
-			logrus.SetLevel(logrus.WarnLevel)
-		case "error":
-			logrus.SetLevel(logrus.ErrorLevel)
-		case "fatal":
-			logrus.SetLevel(logrus.FatalLevel)
-		case "panic":
-			logrus.SetLevel(logrus.PanicLevel)
-		case "trace":
-			logrus.SetLevel(logrus.TraceLevel)
-		default: //
-			logrus.SetLevel(logrus.InfoLevel)
-		}
+		SetLevel(config.GetString("LOGGING_LEVEL", "debug"))
+		// LOGGING_LEVEL may change at runtime
+		config.Subscribe(func(cfg *config.Config, _ []config.Change) {
+			SetLevel(cfg.LoggingLevel)
+		})
 
 		// Extract directory path from logFileName
 		dirPath := filepath.Dir(logFileName)
@@ -93,23 +106,66 @@ func InitLogger() {
 			log.Fatalf("Failed to create logs directory: %v", err)
 		}
 
-		// Create or open the log file
-		var err error
-		logFile, err = os.OpenFile(logFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			log.Fatalf("Failed to create log file: %v", err)
+		// The log file is rotated by size, rotated files are removed by age and count
+		logFile = &lumberjack.Logger{
+			Filename:   logFileName,
+			MaxSize:    config.GetInt("LOGGING_MAX_SIZE_MB", 100),
+			MaxAge:     config.GetInt("LOGGING_MAX_AGE_DAYS", 30),
+			MaxBackups: config.GetInt("LOGGING_MAX_BACKUPS", 10),
+			Compress:   config.GetBool("LOGGING_COMPRESS"),
+			LocalTime:  true,
 		}
 
 		// Set logrus to write to the log file and stdout
 		logrus.SetOutput(io.MultiWriter(logFile, os.Stdout))
 
-		logrus.SetReportCaller(true)
+		SetRedactKeys(strings.Split(config.GetString("LOGGING_REDACT_KEYS", DefaultRedactKeys), ","))
+
+		// Logger writes the callstack of the log call itself, as caller field or message prefix; logrus would
+		// report this file as func/file of every entry
+		logrus.SetReportCaller(false)
 
-		logrus.SetFormatter(new(DefaultFormatter))
+		switch config.GetString("LOGGING_FORMAT", "text") {
+		case "json":
+			jsonFormat = true
+			logrus.SetFormatter(&JSONFormatter{logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}})
+		default:
+			logrus.SetFormatter(new(DefaultFormatter))
+		}
 	})
 }
 
-type delegate func(format string, v ...interface{})
+// SetLevel set the level of every logger, unknown levels are info
+func SetLevel(level string) {
+	switch level {
+	case "debug":
+		logrus.SetLevel(logrus.DebugLevel)
+	case "info":
+		logrus.SetLevel(logrus.InfoLevel)
+	case "warn":
+		logrus.SetLevel(logrus.WarnLevel)
+	case "error":
+		logrus.SetLevel(logrus.ErrorLevel)
+	case "fatal":
+		logrus.SetLevel(logrus.FatalLevel)
+	case "panic":
+		logrus.SetLevel(logrus.PanicLevel)
+	case "trace":
+		logrus.SetLevel(logrus.TraceLevel)
+	default: //
+		logrus.SetLevel(logrus.InfoLevel)
+	}
+}
+
+// CloseLogger flush and close the log file opened by InitLogger
+func CloseLogger() error {
+	if logFile == nil {
+		return nil
+	}
+
+	logrus.SetOutput(os.Stdout)
+	return logFile.Close()
+}
 
 // Logger struct holds logging information
 type Logger struct {
@@ -124,6 +180,8 @@ type Logger struct {
 	LogLevel       string
 	VersionContext string
 	IsSetGWContext bool
+	TraceID        string
+	RequestID      string
 }
 
 // DefaultCBLogger initialize default Logger
@@ -165,12 +223,16 @@ func NewLoggerIdentifier(context string, callStackLevel int, identifier int64) *
 	return &logger
 }
 
-// formatContext formats the log message with additional context
-func (logger *Logger) formatContext(format string) string {
-	if !logger.EnableStack {
-		return format
-	}
+// NewLoggerFromContext initialize Logger with request id and trace id carried by ctx
+func NewLoggerFromContext(ctx context.Context, name string, callStackLevel int) *Logger {
+	logger := NewLogger(name, callStackLevel)
+	logger.RequestID = RequestIDFromContext(ctx)
+
+	return logger.AddTraceContext(ctx)
+}
 
+// callstack caller chain of the log call, must be called from log only
+func (logger *Logger) callstack() string {
 	var callstack string
 	for i := logger.CallStackLevel + 3; i >= 3; i-- {
 		_, file, line, _ := runtime.Caller(i)
@@ -178,49 +240,110 @@ func (logger *Logger) formatContext(format string) string {
 		callstack = fmt.Sprintf("%s/%s:%d", callstack, filename, line)
 	}
 
+	return callstack
+}
+
+// identifier request id, or the numeric identifier when there is no request id
+func (logger *Logger) identifier() string {
 	if logger.GwIdentifier != 0 {
 		logger.Identifier = logger.GwIdentifier
 	}
 
+	if logger.RequestID != "" {
+		return logger.RequestID
+	}
+
+	return fmt.Sprintf("%X", logger.Identifier)
+}
+
+// formatContext formats the log message with additional context
+func (logger *Logger) formatContext(callstack string, format string) string {
+	if !logger.EnableStack {
+		return format
+	}
+
 	if logger.IsSetGWContext == false {
 		logger.GwContext = ""
 	}
 
-	return fmt.Sprintf("[%s] [%X] %s [%s] %s %s%s", callstack, logger.Identifier, logger.GwContext, logger.Context, logger.LogLevel, logger.VersionContext, format)
+	var traceContext string
+	if logger.TraceID != "" {
+		traceContext = fmt.Sprintf(" [trace:%s]", logger.TraceID)
+	}
+
+	return fmt.Sprintf("[%s] [%s]%s %s [%s] %s %s%s", callstack, logger.identifier(), traceContext, logger.GwContext, logger.Context, logger.LogLevel, logger.VersionContext, format)
+}
+
+// fields context of the log as separate keys, for the JSON format
+func (logger *Logger) fields(callstack string) logrus.Fields {
+	fields := logrus.Fields{
+		"request_id": logger.identifier(),
+		"context":    logger.Context,
+	}
+	if logger.LogLevel != "" {
+		fields["layer"] = strings.Trim(logger.LogLevel, "[]")
+	}
+	if logger.TraceID != "" {
+		fields["trace_id"] = logger.TraceID
+	}
+	if logger.EnableStack {
+		fields["caller"] = callstack
+	}
+	if logger.IsSetGWContext {
+		fields["gw_context"] = strings.Trim(logger.GwContext, "[]")
+	}
+	if logger.VersionContext != "" {
+		fields["version"] = strings.Trim(logger.VersionContext, "[] ")
+	}
+
+	return fields
 }
 
 // log logs a message with the given level and format
-func (logger *Logger) log(fn delegate, format string, v ...interface{}) *Logger {
-	message := logger.formatContext(format)
-	fn(message, v...)
+func (logger *Logger) log(level logrus.Level, format string, v ...interface{}) *Logger {
+	callstack := logger.callstack()
+
+	if jsonFormat {
+		logger.Entry.WithFields(logger.fields(callstack)).Logf(level, format, v...)
+		return logger
+	}
 
+	logger.Entry.Logf(level, logger.formatContext(callstack, format), v...)
 	return logger
 }
 
 // Error logs a message at Error level
 func (logger *Logger) Error(format string, v ...interface{}) {
-	logger.log(logrus.Errorf, format, v...)
+	logger.log(logrus.ErrorLevel, format, v...)
 }
 
 // Warn logs a message at Warn level
 func (logger *Logger) Warn(format string, v ...interface{}) {
-	logger.log(logrus.Warnf, format, v...)
+	logger.log(logrus.WarnLevel, format, v...)
 }
 
 // Info logs a message at Info level
 func (logger *Logger) Info(format string, v ...interface{}) {
-	logger.log(logrus.Infof, format, v...)
+	logger.log(logrus.InfoLevel, format, v...)
 }
 
 // Debug logs a message at Debug level
 func (logger *Logger) Debug(format string, v ...interface{}) {
-	logger.log(logrus.Debugf, format, v...)
+	logger.log(logrus.DebugLevel, format, v...)
 }
 
 // Performance logs performance time
 func (logger *Logger) Performance() *Logger {
 	elapsed := time.Since(logger.StartTime)
-	logger.WithField("performance", fmt.Sprintf("%fsec", elapsed.Seconds())).Info("Performance")
+
+	entry := logger.Entry
+	logger.Entry = entry.WithFields(logrus.Fields{
+		"performance": fmt.Sprintf("%fsec", elapsed.Seconds()),
+		"duration_ms": elapsed.Milliseconds(),
+	})
+	logger.log(logrus.InfoLevel, "Performance")
+	logger.Entry = entry
+
 	return logger
 }
 
@@ -230,9 +353,12 @@ func (logger *Logger) Start() *Logger {
 	return logger
 }
 
-// End logs a message for service end
+// End logs a message for service end with the time since Start
 func (logger *Logger) End() {
-	logger.Info("[SERVICEEND]")
+	entry := logger.Entry
+	logger.Entry = entry.WithField("duration_ms", time.Since(logger.StartTime).Milliseconds())
+	logger.log(logrus.InfoLevel, "[SERVICEEND]")
+	logger.Entry = entry
 }
 
 // Controller sets the log level to Controller context
@@ -284,6 +410,21 @@ func (logger *Logger) AddGWIdentifier(identifier string) *Logger {
 	return logger
 }
 
+// AddField adds a field to every following log, sensitive keys are redacted by the formatter
+func (logger *Logger) AddField(key string, value interface{}) *Logger {
+	logger.Entry = logger.Entry.WithField(key, value)
+	return logger
+}
+
+// AddTraceContext adds trace id of the span in ctx to the log
+func (logger *Logger) AddTraceContext(ctx context.Context) *Logger {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if spanContext.HasTraceID() {
+		logger.TraceID = spanContext.TraceID().String()
+	}
+	return logger
+}
+
 // GWSIdentifier gets the gateway identifier as a string
 func (logger *Logger) GWSIdentifier() string {
 	return fmt.Sprintf("%X", logger.GwIdentifier)
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogger_JSONCaller(t *testing.T) {
+	var buf bytes.Buffer
+	logrus.SetOutput(&buf)
+	logrus.SetFormatter(&JSONFormatter{})
+	jsonFormat = true
+	defer func() {
+		logrus.SetOutput(os.Stderr)
+		logrus.SetFormatter(new(logrus.TextFormatter))
+		jsonFormat = false
+	}()
+
+	NewLogger("Test", 0).Info("hello")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	caller, _ := entry["caller"].(string)
+	if !strings.HasPrefix(caller, "/logger_test.go:") {
+		t.Errorf("expected caller in logger_test.go, got %q", caller)
+	}
+	for _, key := range []string{logrus.FieldKeyFunc, logrus.FieldKeyFile} {
+		if _, ok := entry[key]; ok {
+			t.Errorf("expected no %s key, got %v", key, entry[key])
+		}
+	}
+}
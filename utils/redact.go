@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RedactedValue placeholder written in place of a sensitive value
+const RedactedValue = "[REDACTED]"
+
+// DefaultRedactKeys keys redacted when LOGGING_REDACT_KEYS is not set
+const DefaultRedactKeys = "password,secret,token,authorization,api_key,account_number,card_number,pin"
+
+// redactKeys sensitive keys, each as its lower case segments joined
+var redactKeys atomic.Pointer[[]string]
+
+func init() {
+	SetRedactKeys(strings.Split(DefaultRedactKeys, ","))
+}
+
+// SetRedactKeys replace the sensitive keys. A key is sensitive when whole segments of it, split on "_", "-", ".",
+// spaces and camel case, spell one of keys, ignoring case: "api_key" matches "X-Api-Key", "apiKey" and "apikey",
+// "pin" matches "card_pin" but not "shipping", "token" matches "auth.token" but not "tokens_used".
+func SetRedactKeys(keys []string) {
+	joined := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key = strings.Join(keySegments(key), ""); key != "" {
+			joined = append(joined, key)
+		}
+	}
+	redactKeys.Store(&joined)
+}
+
+// IsSensitiveKey check whether values under key must not be logged
+func IsSensitiveKey(key string) bool {
+	segments := keySegments(key)
+	for _, sensitive := range *redactKeys.Load() {
+		for start := range segments {
+			// runs of segments starting at start, growing until they are as long as sensitive
+			run := ""
+			for _, segment := range segments[start:] {
+				if run += segment; len(run) >= len(sensitive) {
+					break
+				}
+			}
+			if run == sensitive {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// RedactFields copy of fields with sensitive values replaced, nested maps included
+func RedactFields(fields logrus.Fields) logrus.Fields {
+	redacted := make(logrus.Fields, len(fields))
+	for key, value := range fields {
+		redacted[key] = redactValue(key, value)
+	}
+
+	return redacted
+}
+
+// Redact JSON of v with sensitive values replaced, for logging request bodies
+func Redact(v interface{}) string {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return RedactedValue
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return RedactedValue
+	}
+
+	body, err = json.Marshal(redactValue("", decoded))
+	if err != nil {
+		return RedactedValue
+	}
+
+	return string(body)
+}
+
+// redactValue redact value when key is sensitive, otherwise walk into maps and slices
+func redactValue(key string, value interface{}) interface{} {
+	if key != "" && IsSensitiveKey(key) {
+		return RedactedValue
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			redacted[k] = redactValue(k, v)
+		}
+		return redacted
+	case map[string]string:
+		redacted := make(map[string]string, len(value))
+		for k, v := range value {
+			if IsSensitiveKey(k) {
+				v = RedactedValue
+			}
+			redacted[k] = v
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(value))
+		for i, v := range value {
+			redacted[i] = redactValue("", v)
+		}
+		return redacted
+	}
+
+	return value
+}
+
+// keySegments lower case words of key, split on separators and camel case, "X-APIKey" gives x, api and key
+func keySegments(key string) []string {
+	var segments []string
+	var word []rune
+	runes := []rune(key)
+	for i, r := range runes {
+		if r == '_' || r == '-' || r == '.' || unicode.IsSpace(r) {
+			if len(word) > 0 {
+				segments, word = append(segments, strings.ToLower(string(word))), nil
+			}
+			continue
+		}
+
+		// a word starts at an upper case letter after a lower case one, or before one ending an acronym
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prev := runes[i-1]
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				segments, word = append(segments, strings.ToLower(string(word))), nil
+			}
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		segments = append(segments, strings.ToLower(string(word)))
+	}
+
+	return segments
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	req := map[string]any{
+		"user_id":        1,
+		"amount":         100,
+		"account_number": "1234567890",
+		"metadata": map[string]string{
+			"order_id":  "ORD-1",
+			"card-pin":  "1234",
+			"authToken": "abc",
+		},
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal([]byte(Redact(req)), &got); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+
+	if got["account_number"] != RedactedValue {
+		t.Errorf("expected account_number redacted, got %v", got["account_number"])
+	}
+	if got["amount"] != float64(100) {
+		t.Errorf("expected amount kept, got %v", got["amount"])
+	}
+
+	metadata := got["metadata"].(map[string]any)
+	if metadata["order_id"] != "ORD-1" {
+		t.Errorf("expected order_id kept, got %v", metadata["order_id"])
+	}
+	for _, key := range []string{"card-pin", "authToken"} {
+		if metadata[key] != RedactedValue {
+			t.Errorf("expected %s redacted, got %v", key, metadata[key])
+		}
+	}
+}
+
+func TestIsSensitiveKey(t *testing.T) {
+	for key, expected := range map[string]bool{
+		"password":        true,
+		"DB_PASSWORD":     true,
+		"X-Api-Key":       true,
+		"apiKey":          true,
+		"APIKey":          true,
+		"apikey":          true,
+		"auth.token":      true,
+		"refresh_token":   true,
+		"card pin":        true,
+		"PIN":             true,
+		"accountNumber":   true,
+		"shipping_method": false,
+		"mapping":         false,
+		"spinner":         false,
+		"tokens_used":     false,
+		"api":             false,
+		"keyboard":        false,
+		"secretary_name":  false,
+	} {
+		if got := IsSensitiveKey(key); got != expected {
+			t.Errorf("%s: expected sensitive %v, got %v", key, expected, got)
+		}
+	}
+}
+
+func TestSetRedactKeys(t *testing.T) {
+	defer SetRedactKeys(strings.Split(DefaultRedactKeys, ","))
+
+	SetRedactKeys([]string{"iban", " "})
+
+	if !IsSensitiveKey("Customer_IBAN") {
+		t.Error("expected configured key to be sensitive")
+	}
+	if IsSensitiveKey("password") {
+		t.Error("expected default keys to be replaced")
+	}
+}
+
+func TestJSONFormatter(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	logger.SetFormatter(&JSONFormatter{})
+
+	logger.WithFields(logrus.Fields{
+		"request_id":  "req-1",
+		"user_id":     7,
+		"api_key":     "secret-key",
+		"duration_ms": 12,
+	}).Info("done")
+
+	var got map[string]any
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json line %q: %v", out.String(), err)
+	}
+
+	if got["request_id"] != "req-1" || got["user_id"] != float64(7) || got["duration_ms"] != float64(12) {
+		t.Errorf("expected fields as keys, got %v", got)
+	}
+	if got["api_key"] != RedactedValue {
+		t.Errorf("expected api_key redacted, got %v", got["api_key"])
+	}
+	if got["msg"] != "done" {
+		t.Errorf("expected msg done, got %v", got["msg"])
+	}
+
+	// the entry itself keeps its fields for hooks and other formatters
+	entry := logrus.NewEntry(logger).WithField("api_key", "secret-key")
+	if _, err := new(JSONFormatter).Format(entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Data["api_key"] != "secret-key" {
+		t.Errorf("expected entry data untouched, got %v", entry.Data["api_key"])
+	}
+}
+
+func TestDefaultFormatterKeepsFields(t *testing.T) {
+	entry := logrus.NewEntry(logrus.New()).WithFields(logrus.Fields{"performance": "0.1sec", "token": "abc"})
+	entry.Message = "Performance"
+
+	line, err := new(DefaultFormatter).Format(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(line), "Performance performance=0.1sec token="+RedactedValue) {
+		t.Errorf("expected sorted redacted fields in %q", line)
+	}
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"wyvern-api/models"
+)
+
+// ProblemContentType RFC 7807 content type
+const ProblemContentType = "application/problem+json"
+
+// ResponseSuccess write success ResponseV2 with data
+func ResponseSuccess(ctx *gin.Context, data any) {
+	resp := models.ResponseV2{
+		Code:    http.StatusOK,
+		Status:  "success",
+		Message: "",
+		Data:    data,
+	}
+	ctx.JSON(resp.Code, resp)
+}
+
+// ResponseError write err and abort the request, http status come from the AppError.
+// Body is application/problem+json when configured or asked by Accept header, ResponseV2 otherwise.
+func ResponseError(ctx *gin.Context, err error) {
+	appErr := models.AsAppError(err)
+
+	if wantProblem(ctx) {
+		problem := models.Problem{
+			Type:      "/errors/" + strings.ToLower(strings.ReplaceAll(appErr.Code, "_", "-")),
+			Title:     appErr.Title,
+			Status:    appErr.Status,
+			Detail:    appErr.Message,
+			Instance:  ctx.Request.URL.Path,
+			Code:      appErr.Code,
+			Errors:    appErr.Fields,
+			RequestID: RequestIDFromContext(ctx.Request.Context()),
+		}
+		ctx.Header("Content-Type", ProblemContentType)
+		ctx.AbortWithStatusJSON(problem.Status, problem)
+		return
+	}
+
+	resp := models.ResponseV2{
+		Code:      appErr.Status,
+		Status:    "error",
+		Message:   appErr.Message,
+		ErrorCode: appErr.Code,
+		Errors:    appErr.Fields,
+		RequestID: RequestIDFromContext(ctx.Request.Context()),
+	}
+	ctx.AbortWithStatusJSON(resp.Code, resp)
+}
+
+// wantProblem check whether error should be written as problem+json
+func wantProblem(ctx *gin.Context) bool {
+	if ErrorFormatFromContext(ctx.Request.Context()) == "problem" {
+		return true
+	}
+
+	return strings.Contains(ctx.GetHeader("Accept"), ProblemContentType)
+}
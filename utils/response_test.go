@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wyvern-api/models"
+)
+
+func TestResponseError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		err         error
+		accept      string
+		format      string
+		status      int
+		code        string
+		contentType string
+	}{
+		{"domain error", models.ErrInsufficientFunds, "", "", http.StatusUnprocessableEntity, "INSUFFICIENT_FUNDS", "application/json; charset=utf-8"},
+		{"wrapped error", models.ErrDatabase.Wrap(errors.New("connection refused")), "", "", http.StatusInternalServerError, "DATABASE_ERROR", "application/json; charset=utf-8"},
+		{"unknown error", errors.New("boom"), "", "", http.StatusInternalServerError, "INTERNAL_ERROR", "application/json; charset=utf-8"},
+		{"problem json", models.ErrUserNotFound, ProblemContentType, "", http.StatusNotFound, "USER_NOT_FOUND", ProblemContentType},
+		{"configured problem json", models.ErrUserNotFound, "", "problem", http.StatusNotFound, "USER_NOT_FOUND", ProblemContentType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/api/transactions/debit", nil)
+			ctx.Request.Header.Set("Accept", tt.accept)
+			ctx.Request = ctx.Request.WithContext(ContextWithErrorFormat(ctx.Request.Context(), tt.format))
+
+			ResponseError(ctx, tt.err)
+
+			if w.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, w.Code)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("expected content type %s, got %s", tt.contentType, got)
+			}
+
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid json body: %v", err)
+			}
+			code := body["error_code"]
+			if tt.contentType == ProblemContentType {
+				code = body["code"]
+			}
+			if code != tt.code {
+				t.Errorf("expected code %s, got %v", tt.code, code)
+			}
+		})
+	}
+}
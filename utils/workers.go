@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+// Workers struct run background goroutines that stop together on shutdown
+type Workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWorkers initiate Workers
+func NewWorkers() *Workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Workers{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Go is method to start worker fn, fn must return soon after its ctx is done
+func (w *Workers) Go(name string, fn func(ctx context.Context)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		log := NewLogger(name, 0)
+		log.Info("worker started")
+		fn(w.ctx)
+		log.Info("worker stopped")
+	}()
+}
+
+// Stop is method to cancel every worker and wait until they return or ctx is done
+func (w *Workers) Stop(ctx context.Context) error {
+	w.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
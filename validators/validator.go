@@ -0,0 +1,130 @@
+package validators
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"wyvern-api/config"
+	"wyvern-api/models"
+)
+
+// limits config the amount rules read, set by Register
+var limits = config.Current
+
+// Register register custom validations on gin validator engine, call it once after config is loaded.
+// Amount rules read their limits from source on every request, config.Current follows the reloaded config.
+// Any request struct can use them through `binding` tag.
+func Register(source func() *config.Config) {
+	limits = source
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		panic("gin validator engine is not go-playground validator")
+	}
+
+	// report field by its json/form name
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "form"} {
+			name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+			if name != "" && name != "-" {
+				return name
+			}
+		}
+		return field.Name
+	})
+
+	mustRegister(v, "max_amount", maxAmount)
+	mustRegister(v, "amount_precision", amountPrecision)
+}
+
+// mustRegister register validation or panic
+func mustRegister(v *validator.Validate, tag string, fn validator.Func) {
+	if err := v.RegisterValidation(tag, fn); err != nil {
+		panic(err)
+	}
+}
+
+// maxAmount amount must be finite and not above TRANSACTION_MAX_AMOUNT
+func maxAmount(fl validator.FieldLevel) bool {
+	amount := fl.Field().Float()
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return false
+	}
+
+	return amount <= limits().TransactionMaxAmount
+}
+
+// amountPrecision amount must not have more decimal places than TRANSACTION_AMOUNT_PRECISION
+func amountPrecision(fl validator.FieldLevel) bool {
+	return decimalPlaces(fl.Field().Float()) <= limits().TransactionAmountPrecision
+}
+
+// decimalPlaces count decimal places of the shortest representation of amount
+func decimalPlaces(amount float64) int {
+	formatted := strconv.FormatFloat(amount, 'f', -1, 64)
+	if i := strings.IndexByte(formatted, '.'); i >= 0 {
+		return len(formatted) - i - 1
+	}
+
+	return 0
+}
+
+// BindError convert ShouldBind error to AppError with field level details
+func BindError(err error) *models.AppError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]models.FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, models.FieldError{
+				Field:   fe.Field(),
+				Rule:    fe.Tag(),
+				Message: message(fe),
+			})
+		}
+		return models.ErrValidation.WithFields(fields).Wrap(err)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		fields := []models.FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("must be a %s", typeErr.Type.Kind()),
+		}}
+		return models.ErrValidation.WithFields(fields).Wrap(err)
+	}
+
+	return models.ErrInvalidRequest.WithMessage("Malformed request body").Wrap(err)
+}
+
+// message human readable message of a failed rule
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be greater than or equal to %s", fe.Param())
+	case "lte":
+		return fmt.Sprintf("must be less than or equal to %s", fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of [%s]", fe.Param())
+	case "max_amount":
+		return fmt.Sprintf("must not exceed %s", strconv.FormatFloat(limits().TransactionMaxAmount, 'f', -1, 64))
+	case "amount_precision":
+		return fmt.Sprintf("must have at most %d decimal places", limits().TransactionAmountPrecision)
+	}
+
+	return fmt.Sprintf("failed on %s rule", fe.Tag())
+}
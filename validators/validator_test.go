@@ -0,0 +1,66 @@
+package validators
+
+import (
+	"github.com/gin-gonic/gin/binding"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wyvern-api/config"
+	"wyvern-api/models"
+)
+
+func TestCreditRequestValidation(t *testing.T) {
+	cfg := &config.Config{TransactionMaxAmount: 1000000, TransactionAmountPrecision: 2}
+	Register(func() *config.Config { return cfg })
+
+	tests := []struct {
+		name   string
+		body   string
+		code   string
+		fields []string
+	}{
+		{"valid", `{"user_id":1,"amount":100.25}`, "", nil},
+		{"missing user", `{"amount":100}`, "VALIDATION_FAILED", []string{"user_id"}},
+		{"zero amount", `{"user_id":1,"amount":0}`, "VALIDATION_FAILED", []string{"amount"}},
+		{"negative amount", `{"user_id":1,"amount":-5}`, "VALIDATION_FAILED", []string{"amount"}},
+		{"too large", `{"user_id":1,"amount":1000000.01}`, "VALIDATION_FAILED", []string{"amount"}},
+		{"too precise", `{"user_id":1,"amount":1.001}`, "VALIDATION_FAILED", []string{"amount"}},
+		{"long description", `{"user_id":1,"amount":1,"description":"` + strings.Repeat("a", 256) + `"}`, "VALIDATION_FAILED", []string{"description"}},
+		{"metadata", `{"user_id":1,"amount":1,"reference":"INV-1","metadata":{"order_id":"X1"}}`, "", nil},
+		{"long metadata value", `{"user_id":1,"amount":1,"metadata":{"order_id":"` + strings.Repeat("a", 256) + `"}}`, "VALIDATION_FAILED", []string{"metadata[order_id]"}},
+		{"wrong type", `{"user_id":"1","amount":1}`, "VALIDATION_FAILED", []string{"user_id"}},
+		{"malformed", `{"user_id":1,`, "INVALID_REQUEST", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/transactions/credit", strings.NewReader(tt.body))
+			var credit models.CreditRequest
+			err := binding.JSON.Bind(req, &credit)
+
+			if tt.code == "" {
+				if err != nil {
+					t.Fatalf("expected valid, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected %s, got nil", tt.code)
+			}
+
+			appErr := BindError(err)
+			if appErr.Code != tt.code {
+				t.Errorf("expected code %s, got %s", tt.code, appErr.Code)
+			}
+			if len(appErr.Fields) != len(tt.fields) {
+				t.Fatalf("expected fields %v, got %+v", tt.fields, appErr.Fields)
+			}
+			for i, field := range tt.fields {
+				if appErr.Fields[i].Field != field {
+					t.Errorf("expected field %s, got %s", field, appErr.Fields[i].Field)
+				}
+			}
+		})
+	}
+}